@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// rdsAPI is the subset of the RDS client used by rdsvalidator.
+type rdsAPI interface {
+	DescribeDBClusters(context.Context, *rds.DescribeDBClustersInput, ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error)
+	DescribeDBInstances(context.Context, *rds.DescribeDBInstancesInput, ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error)
+	DescribeDBClusterSnapshots(context.Context, *rds.DescribeDBClusterSnapshotsInput, ...func(*rds.Options)) (*rds.DescribeDBClusterSnapshotsOutput, error)
+	DescribeDBSnapshots(context.Context, *rds.DescribeDBSnapshotsInput, ...func(*rds.Options)) (*rds.DescribeDBSnapshotsOutput, error)
+	RestoreDBClusterFromSnapshot(context.Context, *rds.RestoreDBClusterFromSnapshotInput, ...func(*rds.Options)) (*rds.RestoreDBClusterFromSnapshotOutput, error)
+	RestoreDBInstanceFromDBSnapshot(context.Context, *rds.RestoreDBInstanceFromDBSnapshotInput, ...func(*rds.Options)) (*rds.RestoreDBInstanceFromDBSnapshotOutput, error)
+	RestoreDBClusterToPointInTime(context.Context, *rds.RestoreDBClusterToPointInTimeInput, ...func(*rds.Options)) (*rds.RestoreDBClusterToPointInTimeOutput, error)
+	RestoreDBInstanceToPointInTime(context.Context, *rds.RestoreDBInstanceToPointInTimeInput, ...func(*rds.Options)) (*rds.RestoreDBInstanceToPointInTimeOutput, error)
+	CreateDBInstance(context.Context, *rds.CreateDBInstanceInput, ...func(*rds.Options)) (*rds.CreateDBInstanceOutput, error)
+	DeleteDBInstance(context.Context, *rds.DeleteDBInstanceInput, ...func(*rds.Options)) (*rds.DeleteDBInstanceOutput, error)
+	DeleteDBCluster(context.Context, *rds.DeleteDBClusterInput, ...func(*rds.Options)) (*rds.DeleteDBClusterOutput, error)
+	CopyDBClusterSnapshot(context.Context, *rds.CopyDBClusterSnapshotInput, ...func(*rds.Options)) (*rds.CopyDBClusterSnapshotOutput, error)
+	CopyDBSnapshot(context.Context, *rds.CopyDBSnapshotInput, ...func(*rds.Options)) (*rds.CopyDBSnapshotOutput, error)
+	DeleteDBClusterSnapshot(context.Context, *rds.DeleteDBClusterSnapshotInput, ...func(*rds.Options)) (*rds.DeleteDBClusterSnapshotOutput, error)
+	DeleteDBSnapshot(context.Context, *rds.DeleteDBSnapshotInput, ...func(*rds.Options)) (*rds.DeleteDBSnapshotOutput, error)
+	ModifyDBClusterSnapshotAttribute(context.Context, *rds.ModifyDBClusterSnapshotAttributeInput, ...func(*rds.Options)) (*rds.ModifyDBClusterSnapshotAttributeOutput, error)
+	ModifyDBSnapshotAttribute(context.Context, *rds.ModifyDBSnapshotAttributeInput, ...func(*rds.Options)) (*rds.ModifyDBSnapshotAttributeOutput, error)
+}
+
+// ec2API is the subset of the EC2 client used by rdsvalidator.
+type ec2API interface {
+	ImportKeyPair(context.Context, *ec2.ImportKeyPairInput, ...func(*ec2.Options)) (*ec2.ImportKeyPairOutput, error)
+	DescribeKeyPairs(context.Context, *ec2.DescribeKeyPairsInput, ...func(*ec2.Options)) (*ec2.DescribeKeyPairsOutput, error)
+	DeleteKeyPair(context.Context, *ec2.DeleteKeyPairInput, ...func(*ec2.Options)) (*ec2.DeleteKeyPairOutput, error)
+	CreateSecurityGroup(context.Context, *ec2.CreateSecurityGroupInput, ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error)
+	DescribeSecurityGroups(context.Context, *ec2.DescribeSecurityGroupsInput, ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error)
+	AuthorizeSecurityGroupIngress(context.Context, *ec2.AuthorizeSecurityGroupIngressInput, ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error)
+	DeleteSecurityGroup(context.Context, *ec2.DeleteSecurityGroupInput, ...func(*ec2.Options)) (*ec2.DeleteSecurityGroupOutput, error)
+	DescribeInstanceTypes(context.Context, *ec2.DescribeInstanceTypesInput, ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error)
+	DescribeImages(context.Context, *ec2.DescribeImagesInput, ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error)
+	RunInstances(context.Context, *ec2.RunInstancesInput, ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error)
+	DescribeInstances(context.Context, *ec2.DescribeInstancesInput, ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	TerminateInstances(context.Context, *ec2.TerminateInstancesInput, ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error)
+	GetConsoleOutput(context.Context, *ec2.GetConsoleOutputInput, ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error)
+}
+
+// ssmAPI is the subset of the SSM client used by rdsvalidator.
+type ssmAPI interface {
+	GetParameter(context.Context, *ssm.GetParameterInput, ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// stsAPI is the subset of the STS client used by rdsvalidator.
+type stsAPI interface {
+	GetCallerIdentity(context.Context, *sts.GetCallerIdentityInput, ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// backend carries the AWS clients every operation works against, so they
+// can be swapped for the in-memory fake, along with where progress goes.
+type backend struct {
+	rds   rdsAPI
+	ec2   ec2API
+	ssm   ssmAPI
+	sts   stsAPI
+	sleep func(context.Context, time.Duration) error
+	// finds the address our traffic to the proxy comes from
+	egressIP func(context.Context) (string, error)
+	out      io.Writer
+	errOut   io.Writer
+
+	// where b works, as recorded in ledgers
+	opts    sessionOptions
+	region  string
+	account string
+
+	source bool // whether this is the source of another backend
+
+	// where snapshots are looked up when they live in another region or
+	// account
+	src *backend
+}
+
+func newBackend(ctx context.Context) (*backend, error) {
+	target := sessionOptions{region: awsRegion, profile: awsProfile, roleARN: roleARN}
+	b, err := newAWSBackend(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(copyFromRegion) == 0 && len(sourceProfile) == 0 && len(sourceRoleARN) == 0 {
+		return b, nil
+	}
+
+	b.src, err = newAWSBackend(ctx, b.sourceSession())
+	if err != nil {
+		return nil, err
+	}
+	b.src.source = true
+
+	return b, nil
+}
+
+// sourceSession returns options for looking snapshots up with the source
+// flags. Unless --copy-from-region says otherwise the source works in b's
+// resolved region, not whatever its own profile defaults to, as snapshots
+// from another region can only be used by copying them.
+func (b *backend) sourceSession() sessionOptions {
+	source := b.opts
+	source.region = b.region
+	if len(copyFromRegion) > 0 {
+		source.region = copyFromRegion
+	}
+	if len(sourceProfile) > 0 || len(sourceRoleARN) > 0 {
+		source.profile = sourceProfile
+		source.roleARN = sourceRoleARN
+	}
+	return source
+}
+
+// newBackendFor builds a backend working in target, which looks snapshots
+// up in source when one is given.
+func newBackendFor(ctx context.Context, target sessionOptions, source *sessionOptions) (*backend, error) {
+	b, err := newAWSBackend(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return b, nil
+	}
+
+	b.src, err = newAWSBackend(ctx, *source)
+	if err != nil {
+		return nil, err
+	}
+	b.src.source = true
+
+	return b, nil
+}
+
+// newAWSBackend builds every client from a single session, so they share
+// credentials, region, retry and endpoint settings.
+func newAWSBackend(ctx context.Context, opts sessionOptions) (*backend, error) {
+	cfg, err := newSession(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &backend{
+		rds:      rds.NewFromConfig(cfg),
+		ec2:      ec2.NewFromConfig(cfg),
+		ssm:      ssm.NewFromConfig(cfg),
+		sts:      sts.NewFromConfig(cfg),
+		sleep:    sleepContext,
+		egressIP: checkEgressIP,
+		out:      os.Stdout,
+		errOut:   os.Stderr,
+		opts:     opts,
+		region:   cfg.Region,
+	}
+	b.account, err = b.callerAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// callerAccount returns the ID of the account b's credentials belong to.
+func (b *backend) callerAccount(ctx context.Context) (string, error) {
+	output, err := b.sts.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.Account), nil
+}
+
+// location returns where b creates resources.
+func (b *backend) location() *location {
+	return &location{Region: b.region, Account: b.account, Profile: b.opts.profile, RoleARN: b.opts.roleARN}
+}
+
+// lookup returns the backend snapshots and source databases are found with.
+func (b *backend) lookup() *backend {
+	if b.src != nil {
+		return b.src
+	}
+	return b
+}
+
+// crossAccount reports whether snapshots come from another account.
+func (b *backend) crossAccount() bool {
+	return b.src != nil && b.src.account != b.account
+}
+
+// record adds a resource to l, noting when it lives in the source account.
+func (b *backend) record(l *ledger, kind, id string) error {
+	if b.source {
+		return l.addSource(kind, id)
+	}
+	return l.add(kind, id)
+}
+
+// withPrefix returns a copy of b whose output lines are tagged with prefix,
+// keeping concurrent runs readable.
+func (b *backend) withPrefix(prefix string) *backend {
+	c := *b
+	c.out = &prefixWriter{w: os.Stdout, prefix: prefix}
+	c.errOut = &prefixWriter{w: os.Stderr, prefix: prefix}
+	if c.src != nil {
+		c.src = c.src.withPrefix(prefix)
+	}
+	return &c
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// failed deletions are retried this many times in all, backing off between
+// passes
+const (
+	cleanupAttempts   = 3
+	cleanupRetryDelay = 30 * time.Second
+)
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Tear down resources recorded in a state file by a previous run",
+	Run:   runCleanup,
+}
+
+func init() {
+	cleanupCmd.Flags().StringVar(&stateFile, "state", stateFile, "state file written by a previous run")
+	rootCmd.AddCommand(cleanupCmd)
+}
+
+func runCleanup(cmd *cobra.Command, args []string) {
+	if len(stateFile) == 0 {
+		fatal(exitUsage, "USAGE: Must provide --state")
+	}
+
+	ctx := context.Background()
+
+	l, err := loadLedger(stateFile)
+	if err != nil {
+		fatal(exitError, err)
+	}
+
+	b, err := ledgerBackend(ctx, l)
+	if err != nil {
+		fatal(exitError, err)
+	}
+
+	if len(teardown(ctx, b, l)) > 0 {
+		os.Exit(exitCleanup)
+	}
+}
+
+// ledgerBackend works where l's run did rather than wherever this run's
+// flags point, since resources looked for in the wrong place would seem
+// to be deleted already. --aws-profile and --role-arn, and their source
+// counterparts, may stand in for the recorded credentials as long as they
+// reach the same account.
+func ledgerBackend(ctx context.Context, l *ledger) (*backend, error) {
+	if l.Target == nil {
+		return nil, fmt.Errorf("%s does not record where run %s worked", l.path, l.RunID)
+	}
+	if len(awsRegion) > 0 && awsRegion != l.Target.Region {
+		return nil, fmt.Errorf("run %s worked in %s, not --region %s", l.RunID, l.Target.Region, awsRegion)
+	}
+
+	target := l.Target.session(awsProfile, roleARN)
+	var source *sessionOptions
+	if l.Source != nil {
+		s := l.Source.session(sourceProfile, sourceRoleARN)
+		source = &s
+	}
+
+	b, err := newBackendFor(ctx, target, source)
+	if err != nil {
+		return nil, err
+	}
+	return b, b.checkLocation(l)
+}
+
+// session returns options for working in loc, with profile and roleARN
+// replacing the recorded credentials when either is given.
+func (loc *location) session(profile, roleARN string) sessionOptions {
+	opts := sessionOptions{region: loc.Region, profile: loc.Profile, roleARN: loc.RoleARN}
+	if len(profile) > 0 || len(roleARN) > 0 {
+		opts.profile = profile
+		opts.roleARN = roleARN
+	}
+	return opts
+}
+
+// checkLocation makes sure b, and its source, work in the region and
+// account l's run did.
+func (b *backend) checkLocation(l *ledger) error {
+	err := b.location().matches(l.Target)
+	if err != nil {
+		return fmt.Errorf("run %s: %w", l.RunID, err)
+	}
+	if l.Source == nil {
+		return nil
+	}
+	if b.src == nil {
+		return fmt.Errorf("run %s used backups in account %s, %s, provide its credentials", l.RunID, l.Source.Account, l.Source.Region)
+	}
+	err = b.src.location().matches(l.Source)
+	if err != nil {
+		return fmt.Errorf("run %s source: %w", l.RunID, err)
+	}
+	return nil
+}
+
+func (loc *location) matches(want *location) error {
+	if loc.Account != want.Account || loc.Region != want.Region {
+		return fmt.Errorf("worked in account %s, %s, but the credentials given are for account %s, %s", want.Account, want.Region, loc.Account, loc.Region)
+	}
+	return nil
+}
+
+// teardown deletes recorded resources newest first, dropping each from the
+// ledger once it is gone. It returns an error for every resource left behind.
+func teardown(ctx context.Context, b *backend, l *ledger) []error {
+	errs := b.deleteAll(ctx, l.reversed(), func(r resource) {
+		err := l.remove(r)
+		if err != nil {
+			logger.Println(err)
+		}
+	})
+
+	if len(errs) > 0 {
+		fmt.Fprintf(b.out, "%d resources remaining in %s:\n", len(errs), l.path)
+		for _, err := range errs {
+			fmt.Fprintf(b.out, "  %v\n", err)
+		}
+		return errs
+	}
+
+	err := os.Remove(l.path)
+	if err != nil {
+		logger.Println(err)
+	}
+
+	return nil
+}
+
+// deleteAll deletes resources in order, calling deleted for each one that
+// is gone. Failures are retried in later passes, since a resource often
+// can't be deleted until one after it has been.
+func (b *backend) deleteAll(ctx context.Context, resources []resource, deleted func(resource)) []error {
+	var errs []error
+
+	for attempt := 1; ; attempt++ {
+		var failed []resource
+		errs = nil
+
+		for _, r := range resources {
+			err := b.deleteResource(ctx, r)
+			if err != nil {
+				logger.Println(err)
+				failed = append(failed, r)
+				errs = append(errs, fmt.Errorf("%s %s: %w", r.Kind, r.ID, err))
+				continue
+			}
+			deleted(r)
+		}
+
+		if len(failed) == 0 || attempt == cleanupAttempts {
+			return errs
+		}
+
+		delay := time.Duration(attempt) * cleanupRetryDelay
+		fmt.Fprintf(b.out, "%d resources could not be deleted, retrying in %s...\n", len(failed), delay)
+		if b.sleep(ctx, delay) != nil {
+			return errs
+		}
+		resources = failed
+	}
+}
+
+func (b *backend) deleteResource(ctx context.Context, r resource) error {
+	if r.Source && !b.source {
+		if b.src == nil {
+			return fmt.Errorf("%s %s is in the source account, provide its credentials to delete it", r.Kind, r.ID)
+		}
+		return b.src.deleteResource(ctx, r)
+	}
+
+	switch r.Kind {
+	case kindKeypair:
+		return b.deleteKeypair(ctx, r.ID)
+	case kindProxy:
+		return b.deleteProxy(ctx, r.ID)
+	case kindDBInstance:
+		return b.deleteDatabaseInstance(ctx, r.ID)
+	case kindDBCluster:
+		return b.deleteDatabaseCluster(ctx, r.ID)
+	case kindDBClusterSnapshot:
+		return b.deleteClusterSnapshot(ctx, r.ID)
+	case kindDBSnapshot:
+		return b.deleteInstanceSnapshot(ctx, r.ID)
+	case kindSecurityGroup:
+		return b.deleteSecurityGroup(ctx, r.ID)
+	}
+
+	return fmt.Errorf("unknown resource kind %q", r.Kind)
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func newTestLedger(t *testing.T, b *backend) *ledger {
+	t.Helper()
+	l, err := newLedger(filepath.Join(t.TempDir(), "state.json"), "testrun1", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestTeardownReverseOrder(t *testing.T) {
+	ctx := context.Background()
+	b, f := newFakeBackend()
+	l := newTestLedger(t, b)
+
+	sg, err := b.createSecurityGroup(ctx, "vpc-1", "proxy", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := b.createKeypair(ctx, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := teardown(ctx, b, l); len(errs) > 0 {
+		t.Fatalf("teardown failed: %v", errs)
+	}
+	checkDeletions(t, f, kindKeypair+" "+k.ID, kindSecurityGroup+" "+aws.ToString(sg.GroupId))
+	if _, err := os.Stat(l.path); !os.IsNotExist(err) {
+		t.Errorf("state file %s kept after a clean teardown", l.path)
+	}
+}
+
+func TestTeardownReportsLeftovers(t *testing.T) {
+	ctx := context.Background()
+	b, f := newFakeBackend()
+	l := newTestLedger(t, b)
+
+	sleeps := 0
+	b.sleep = func(ctx context.Context, _ time.Duration) error {
+		sleeps++
+		return ctx.Err()
+	}
+
+	sg, err := b.createSecurityGroup(ctx, "vpc-1", "proxy", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.add("unknown-kind", "x-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sleeps = 0
+
+	errs := teardown(ctx, b, l)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "x-1") {
+		t.Fatalf("got %v, want one error for x-1", errs)
+	}
+	if sleeps != cleanupAttempts-1 {
+		t.Errorf("backed off %d times, want %d", sleeps, cleanupAttempts-1)
+	}
+	checkDeletions(t, f, kindSecurityGroup+" "+aws.ToString(sg.GroupId))
+
+	left, err := loadLedger(l.path)
+	if err != nil {
+		t.Fatalf("state file not kept: %v", err)
+	}
+	if len(left.Resources) != 1 || left.Resources[0].ID != "x-1" {
+		t.Errorf("state file lists %v, want only x-1", left.Resources)
+	}
+}
+
+func TestDeleteAllRetriesDependencies(t *testing.T) {
+	ctx := context.Background()
+	b, f := newFakeBackend()
+	l := newTestLedger(t, b)
+
+	proxySG, err := b.createSecurityGroup(ctx, "vpc-1", "proxy", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbSG, err := b.createSecurityGroup(ctx, "vpc-1", "database", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.allowGroup(ctx, aws.ToString(dbSG.GroupId), aws.ToString(proxySG.GroupId), 5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in creation order, so the proxy group is still referenced at first
+	var deleted []string
+	errs := b.deleteAll(ctx, l.Resources, func(r resource) { deleted = append(deleted, r.ID) })
+	if len(errs) > 0 {
+		t.Fatalf("deleteAll failed: %v", errs)
+	}
+	want := []string{aws.ToString(dbSG.GroupId), aws.ToString(proxySG.GroupId)}
+	if strings.Join(deleted, ",") != strings.Join(want, ",") {
+		t.Errorf("deleted %v, want %v", deleted, want)
+	}
+	checkDeletions(t, f, kindSecurityGroup+" "+want[0], kindSecurityGroup+" "+want[1])
+}
+
+func TestDeleteSourceResourceNeedsCredentials(t *testing.T) {
+	b, _ := newFakeBackend()
+
+	err := b.deleteResource(context.Background(), resource{Kind: kindDBSnapshot, ID: "rdsvalidator-x", Source: true})
+	if err == nil || !strings.Contains(err.Error(), "source account") {
+		t.Fatalf("got %v, want an error asking for source credentials", err)
+	}
+}
+
+func TestDeleteAlreadyGone(t *testing.T) {
+	b, f := newFakeBackend()
+
+	gone := []resource{
+		{Kind: kindProxy, ID: "i-00000000000000000"},
+		{Kind: kindSecurityGroup, ID: "sg-00000000000000000"},
+		{Kind: kindKeypair, ID: "key-00000000000000000"},
+	}
+	var deleted []string
+	errs := b.deleteAll(context.Background(), gone, func(r resource) { deleted = append(deleted, r.ID) })
+	if len(errs) > 0 {
+		t.Fatalf("deleteAll failed: %v", errs)
+	}
+	if len(deleted) != len(gone) {
+		t.Errorf("dropped %v from the ledger, want all of %v", deleted, gone)
+	}
+	checkDeletions(t, f)
+}
+
+func TestDeleteProxyWaitsForTermination(t *testing.T) {
+	ctx := context.Background()
+	b, f := newFakeBackend()
+
+	out, err := f.RunInstances(ctx, &ec2.RunInstancesInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := aws.ToString(out.Instances[0].InstanceId)
+
+	err = b.deleteProxy(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.terminations != 1 {
+		t.Errorf("terminated %d times, want once", f.terminations)
+	}
+	if state := f.hosts[id].State.Name; state != ec2types.InstanceStateNameTerminated {
+		t.Errorf("proxy is %s, want terminated", state)
+	}
+	checkDeletions(t, f, kindProxy+" "+id)
+}
+
+func TestLedgerRecordsLocation(t *testing.T) {
+	b, _ := newFakeBackend()
+	withFakeSource(b, fakeSourceAccount)
+	b.opts.roleARN = "arn:aws:iam::000000000000:role/validator"
+
+	l := newTestLedger(t, b)
+	loaded, err := loadLedger(l.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := location{Region: fakeRegion, Account: fakeAccount, RoleARN: b.opts.roleARN}
+	if loaded.Target == nil || *loaded.Target != want {
+		t.Errorf("recorded target %+v, want %+v", loaded.Target, want)
+	}
+	if loaded.Source == nil || loaded.Source.Account != fakeSourceAccount {
+		t.Errorf("recorded source %+v, want account %s", loaded.Source, fakeSourceAccount)
+	}
+	if err := b.checkLocation(loaded); err != nil {
+		t.Errorf("same backend refused: %v", err)
+	}
+}
+
+func TestCheckLocationRefusesElsewhere(t *testing.T) {
+	b, _ := newFakeBackend()
+	withFakeSource(b, fakeSourceAccount)
+	l := newTestLedger(t, b)
+
+	tests := []struct {
+		name string
+		edit func(*backend)
+	}{
+		{"other region", func(c *backend) { c.region = "eu-west-1" }},
+		{"other account", func(c *backend) { c.account = "222222222222" }},
+		{"other source account", func(c *backend) {
+			src := *c.src
+			src.account = "222222222222"
+			c.src = &src
+		}},
+		{"no source", func(c *backend) { c.src = nil }},
+	}
+	for _, tt := range tests {
+		c := *b
+		tt.edit(&c)
+		if err := c.checkLocation(l); err == nil {
+			t.Errorf("%s: cleanup allowed", tt.name)
+		}
+	}
+}
+
+func TestLocationSession(t *testing.T) {
+	loc := location{Region: "us-west-2", Account: fakeAccount, Profile: "prod"}
+
+	if got := loc.session("", ""); got != (sessionOptions{region: "us-west-2", profile: "prod"}) {
+		t.Errorf("recorded credentials gave %+v", got)
+	}
+	// a role given now replaces the recorded profile entirely
+	if got := loc.session("", "arn:aws:iam::000000000000:role/x"); got != (sessionOptions{region: "us-west-2", roleARN: "arn:aws:iam::000000000000:role/x"}) {
+		t.Errorf("--role-arn gave %+v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	cfgFile     string
+	profileName string
+)
+
+func initConfig() {
+	viper.SetEnvPrefix("RV")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv() // read in environment variables that match RV_*
+}
+
+// loadConfig reads the config file and layers the selected profile over its
+// defaults. The result sits below RV_* environment variables in viper.
+func loadConfig() error {
+	explicit := len(cfgFile) > 0
+	if !explicit {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		cfgFile = filepath.Join(home, ".rdsvalidator.yaml")
+	}
+
+	v := viper.New()
+	v.SetConfigFile(cfgFile)
+	err := v.ReadInConfig()
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			if len(profileName) > 0 {
+				return fmt.Errorf("profile %q requested but %s does not exist", profileName, cfgFile)
+			}
+			return nil
+		}
+		return err
+	}
+
+	settings := v.GetStringMap("defaults")
+	if len(profileName) > 0 {
+		key := "profiles." + profileName
+		if !v.IsSet(key) {
+			return fmt.Errorf("profile %q not found in %s", profileName, cfgFile)
+		}
+		for k, val := range v.GetStringMap(key) {
+			settings[k] = val
+		}
+	}
+
+	return viper.MergeConfigMap(settings)
+}
+
+// applyConfig fills every flag the user did not set from the environment or
+// config file, giving flags > RV_* env > profile > defaults.
+func applyConfig(cmd *cobra.Command, args []string) error {
+	for _, name := range []string{"config", "profile"} {
+		f := cmd.Flags().Lookup(name)
+		if f != nil && !f.Changed && viper.IsSet(name) {
+			err := f.Value.Set(viper.GetString(name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || !viper.IsSet(f.Name) {
+			return
+		}
+
+		var val string
+		switch v := viper.Get(f.Name).(type) {
+		case []interface{}:
+			val = strings.Join(cast.ToStringSlice(v), ",")
+		default:
+			val = cast.ToString(v)
+		}
+
+		err = cmd.Flags().Set(f.Name, val)
+		if err != nil {
+			err = fmt.Errorf("invalid value for %s: %w", f.Name, err)
+		}
+	})
+
+	return err
+}
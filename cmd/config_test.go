@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rdsvalidator.yaml")
+	err := os.WriteFile(path, []byte(`defaults:
+  region: us-west-1
+  instance-type: db.r5.large
+  max-attempts: 3
+  proxy-user: ec2-user
+profiles:
+  prod:
+    region: eu-west-1
+    instance-type: db.r6g.large
+    proxy-ingress-cidr: [10.0.0.0/8, 192.168.0.0/16]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// viper is global, so start from and leave it as the CLI sets it up
+	viper.Reset()
+	initConfig()
+	t.Cleanup(func() {
+		viper.Reset()
+		initConfig()
+	})
+	setGlobal(t, &cfgFile, "")
+	setGlobal(t, &profileName, "")
+	t.Setenv("RV_CONFIG", path)
+	t.Setenv("RV_INSTANCE_TYPE", "db.t3.small")
+	t.Setenv("RV_MAX_ATTEMPTS", "5")
+
+	var (
+		region, instance, user string
+		attempts, port         int
+		ingress                []string
+	)
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().StringVar(&cfgFile, "config", cfgFile, "")
+	cmd.Flags().StringVar(&profileName, "profile", profileName, "")
+	cmd.Flags().StringVar(&region, "region", "", "")
+	cmd.Flags().StringVar(&instance, "instance-type", "db.t3.medium", "")
+	cmd.Flags().StringVar(&user, "proxy-user", "ubuntu", "")
+	cmd.Flags().IntVar(&attempts, "max-attempts", 0, "")
+	cmd.Flags().IntVar(&port, "proxy-port", 22, "")
+	cmd.Flags().StringSliceVar(&ingress, "proxy-ingress-cidr", nil, "")
+	err = cmd.ParseFlags([]string{"--profile", "prod", "--region", "us-east-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = applyConfig(cmd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct{ name, got, want string }{
+		{"config from RV_CONFIG", cfgFile, path},
+		{"flag over profile", region, "us-east-2"},
+		{"RV_* over profile", instance, "db.t3.small"},
+		{"RV_* over defaults", strconv.Itoa(attempts), "5"},
+		{"profile over defaults", strings.Join(ingress, ","), "10.0.0.0/8,192.168.0.0/16"},
+		{"defaults over flag defaults", user, "ec2-user"},
+		{"flag default when unset", strconv.Itoa(port), "22"},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, c.got, c.want)
+		}
+	}
+}
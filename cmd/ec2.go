@@ -2,178 +2,361 @@ package cmd
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go"
+	"golang.org/x/crypto/ssh"
 )
 
 type ec2Instance struct {
 	Instance types.Instance
 	Group    *ec2.CreateSecurityGroupOutput
-	Keypair  *ec2.CreateKeyPairOutput
+	Keypair  keypair
+	HostKeys []string // SHA256 fingerprints from the console output
 }
 
-func ec2Client(ctx context.Context) (*ec2.Client, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	return ec2.NewFromConfig(cfg), nil
+// keypair is a proxy key registered with EC2. The private half is generated
+// here and never leaves the process.
+type keypair struct {
+	Name   string
+	ID     string
+	Signer ssh.Signer
 }
 
-func createKeypair(ctx context.Context) (*ec2.CreateKeyPairOutput, error) {
-	k := &ec2.CreateKeyPairOutput{}
+func (b *backend) createKeypair(ctx context.Context, l *ledger) (keypair, error) {
+	k := keypair{Name: "rdsvalidator-" + randomString(8)}
 
-	client, err := ec2Client(ctx)
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return k, err
+	}
+	k.Signer, err = ssh.NewSignerFromKey(priv)
 	if err != nil {
 		return k, err
 	}
 
-	kpName := "rdsvalidator-" + randomString(8)
-	fmt.Printf("Creating keypair %s...", kpName)
-
-	k, err = client.CreateKeyPair(ctx, &ec2.CreateKeyPairInput{
-		KeyName: aws.String(kpName),
-		KeyType: types.KeyTypeEd25519,
+	fmt.Fprintf(b.out, "Importing keypair %s...", k.Name)
+	kout, err := b.ec2.ImportKeyPair(ctx, &ec2.ImportKeyPairInput{
+		KeyName:           aws.String(k.Name),
+		PublicKeyMaterial: ssh.MarshalAuthorizedKey(k.Signer.PublicKey()),
+		TagSpecifications: ec2Tags(l.RunID, types.ResourceTypeKeyPair),
 	})
 	if err != nil {
 		return k, err
 	}
+	k.ID = aws.ToString(kout.KeyPairId)
+	err = l.add(kindKeypair, k.ID)
+	if err != nil {
+		return k, err
+	}
 
-	for {
-		time.Sleep(1 * time.Second)
-		kd, err := client.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{
-			KeyNames: []string{kpName},
+	err = b.poll(ctx, "keypair "+k.Name, 1*time.Second, ec2WaitLimit, func(ctx context.Context) (bool, error) {
+		kd, err := b.ec2.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{
+			KeyNames: []string{k.Name},
 		})
-		if err != nil {
-			return k, err
+		// EC2 is eventually consistent, so new resources may not be found yet
+		if isEC2Error(err, "InvalidKeyPair.NotFound") {
+			return false, nil
 		}
-		if len(kd.KeyPairs) > 0 {
-			fmt.Println("done.")
-			break
+		if err != nil {
+			return false, err
 		}
-		fmt.Print(".")
+		return len(kd.KeyPairs) > 0, nil
+	})
+	if err != nil {
+		return k, err
 	}
+	fmt.Fprintln(b.out, "done.")
 
 	return k, nil
 }
 
-func deleteKeypair(ctx context.Context, keypairID string) error {
-	client, err := ec2Client(ctx)
-	if err != nil {
-		return err
-	}
-
-	fmt.Printf("Deleting keypair %s...", keypairID)
-	_, err = client.DeleteKeyPair(ctx, &ec2.DeleteKeyPairInput{
+func (b *backend) deleteKeypair(ctx context.Context, keypairID string) error {
+	fmt.Fprintf(b.out, "Deleting keypair %s...", keypairID)
+	_, err := b.ec2.DeleteKeyPair(ctx, &ec2.DeleteKeyPairInput{
 		KeyPairId: aws.String(keypairID),
 	})
-	if err != nil {
+	if err != nil && !isEC2Error(err, "InvalidKeyPair.NotFound") {
 		return err
 	}
-	fmt.Println("done.")
+	fmt.Fprintln(b.out, "done.")
 
 	return nil
 }
 
-// TODO: allow passing list of ingress cidrs
-func createSecurityGroup(ctx context.Context, vpcID string) (*ec2.CreateSecurityGroupOutput, error) {
+// createSecurityGroup creates an empty group in vpcID; purpose ends up in
+// its description.
+func (b *backend) createSecurityGroup(ctx context.Context, vpcID, purpose string, l *ledger) (*ec2.CreateSecurityGroupOutput, error) {
 	g := &ec2.CreateSecurityGroupOutput{}
 
-	client, err := ec2Client(ctx)
-	if err != nil {
-		return g, err
-	}
-
 	sgName := "rdsvalidator-" + randomString(8)
-	fmt.Printf("Creating security group %s...", sgName)
+	fmt.Fprintf(b.out, "Creating security group %s...", sgName)
 
-	g, err = client.CreateSecurityGroup(ctx, &ec2.CreateSecurityGroupInput{
-		GroupName:   aws.String(sgName),
-		Description: aws.String("grant temporary access for rds validator"),
-		VpcId:       aws.String(vpcID),
+	g, err := b.ec2.CreateSecurityGroup(ctx, &ec2.CreateSecurityGroupInput{
+		GroupName:         aws.String(sgName),
+		Description:       aws.String("grant temporary access for rds validator " + purpose),
+		VpcId:             aws.String(vpcID),
+		TagSpecifications: ec2Tags(l.RunID, types.ResourceTypeSecurityGroup),
 	})
 	if err != nil {
 		return g, err
 	}
+	err = l.add(kindSecurityGroup, aws.ToString(g.GroupId))
+	if err != nil {
+		return g, err
+	}
 
-	for {
-		time.Sleep(1 * time.Second)
-		gd, err := client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+	err = b.poll(ctx, "security group "+sgName, 1*time.Second, ec2WaitLimit, func(ctx context.Context) (bool, error) {
+		gd, err := b.ec2.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
 			GroupIds: []string{aws.ToString(g.GroupId)},
 		})
-		if err != nil {
-			return g, err
+		if isEC2Error(err, "InvalidGroup.NotFound") {
+			return false, nil
 		}
-		if gd.SecurityGroups[0].IpPermissionsEgress != nil {
-			fmt.Println("done.")
-			break
+		if err != nil {
+			return false, err
 		}
-		fmt.Print(".")
-	}
-
-	_, err = client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId:    g.GroupId,
-		CidrIp:     aws.String("0.0.0.0/0"),
-		FromPort:   aws.Int32(22),
-		ToPort:     aws.Int32(22),
-		IpProtocol: aws.String("tcp"),
+		return len(gd.SecurityGroups) > 0 && gd.SecurityGroups[0].IpPermissionsEgress != nil, nil
 	})
 	if err != nil {
 		return g, err
 	}
+	fmt.Fprintln(b.out, "done.")
+
+	return g, nil
+}
+
+// allowCIDRs lets cidrs, IPv4 or IPv6, reach port in groupID.
+func (b *backend) allowCIDRs(ctx context.Context, groupID string, port int, cidrs []string) error {
+	perm := types.IpPermission{
+		FromPort:   aws.Int32(int32(port)),
+		ToPort:     aws.Int32(int32(port)),
+		IpProtocol: aws.String("tcp"),
+	}
+	for _, c := range cidrs {
+		if strings.Contains(c, ":") {
+			perm.Ipv6Ranges = append(perm.Ipv6Ranges, types.Ipv6Range{CidrIpv6: aws.String(c)})
+		} else {
+			perm.IpRanges = append(perm.IpRanges, types.IpRange{CidrIp: aws.String(c)})
+		}
+	}
 
-	_, err = client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId:                 g.GroupId,
-		SourceSecurityGroupName: aws.String(sgName),
+	fmt.Fprintf(b.out, "Allowing %s to port %d of %s...", strings.Join(cidrs, ", "), port, groupID)
+	_, err := b.ec2.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       aws.String(groupID),
+		IpPermissions: []types.IpPermission{perm},
 	})
 	if err != nil {
-		return g, err
+		return err
 	}
+	fmt.Fprintln(b.out, "done.")
 
-	return g, nil
+	return nil
 }
 
-func deleteSecurityGroup(ctx context.Context, groupID string) error {
-	client, err := ec2Client(ctx)
+// allowGroup lets members of sourceGroupID reach port in groupID.
+func (b *backend) allowGroup(ctx context.Context, groupID, sourceGroupID string, port int) error {
+	fmt.Fprintf(b.out, "Allowing %s to port %d of %s...", sourceGroupID, port, groupID)
+	_, err := b.ec2.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId: aws.String(groupID),
+		IpPermissions: []types.IpPermission{
+			{
+				FromPort:         aws.Int32(int32(port)),
+				ToPort:           aws.Int32(int32(port)),
+				IpProtocol:       aws.String("tcp"),
+				UserIdGroupPairs: []types.UserIdGroupPair{{GroupId: aws.String(sourceGroupID)}},
+			},
+		},
+	})
 	if err != nil {
 		return err
 	}
+	fmt.Fprintln(b.out, "done.")
+
+	return nil
+}
 
-	fmt.Printf("Deleting security group %s...", groupID)
-	_, err = client.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{
+func (b *backend) deleteSecurityGroup(ctx context.Context, groupID string) error {
+	fmt.Fprintf(b.out, "Deleting security group %s...", groupID)
+	_, err := b.ec2.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{
 		GroupId: aws.String(groupID),
 	})
-	if err != nil {
+	if err != nil && !isEC2Error(err, "InvalidGroup.NotFound") {
 		return err
 	}
-	fmt.Println("done.")
+	fmt.Fprintln(b.out, "done.")
 
 	return nil
 }
 
-func createProxy(ctx context.Context, groupID string) (ec2Instance, error) {
+// isEC2Error reports whether err is the EC2 error with code, which unlike
+// RDS faults have no types of their own.
+func isEC2Error(err error, code string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code
+}
+
+func (b *backend) createProxy(ctx context.Context, groupID string, l *ledger) (ec2Instance, error) {
 	i := ec2Instance{}
 
-	client, err := ec2Client(ctx)
+	k, err := b.createKeypair(ctx, l)
 	if err != nil {
 		return i, err
 	}
+	i.Keypair = k
 
-	k, err := createKeypair(ctx)
+	imageID, err := b.proxyImage(ctx)
 	if err != nil {
 		return i, err
 	}
-	i.Keypair = k
 
-	// TODO: allow passing ami id
-	img, err := client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+	iout, err := b.ec2.RunInstances(ctx, &ec2.RunInstancesInput{
+		MaxCount:     aws.Int32(1),
+		MinCount:     aws.Int32(1),
+		ImageId:      aws.String(imageID),
+		InstanceType: types.InstanceType(proxyInstanceType),
+		KeyName:      aws.String(k.Name),
+		NetworkInterfaces: []types.InstanceNetworkInterfaceSpecification{
+			{
+				AssociatePublicIpAddress: aws.Bool(true),
+				DeleteOnTermination:      aws.Bool(true),
+				DeviceIndex:              aws.Int32(0),
+				Groups:                   []string{groupID},
+				SubnetId:                 aws.String(proxySubnet),
+			},
+		},
+		TagSpecifications: ec2Tags(l.RunID, types.ResourceTypeInstance, types.ResourceTypeVolume),
+	})
+	if err != nil {
+		return i, err
+	}
+
+	instanceID := aws.ToString(iout.Instances[0].InstanceId)
+	err = l.add(kindProxy, instanceID)
+	if err != nil {
+		return i, err
+	}
+	fmt.Fprintf(b.out, "Creating ec2 instance %s...", instanceID)
+
+	err = b.poll(ctx, "ec2 instance "+instanceID, 1*time.Second, ec2WaitLimit, func(ctx context.Context) (bool, error) {
+		id, err := b.ec2.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+			InstanceIds: []string{instanceID},
+		})
+		if isEC2Error(err, "InvalidInstanceID.NotFound") {
+			return false, nil
+		}
+		if err != nil || len(id.Reservations) == 0 || len(id.Reservations[0].Instances) == 0 {
+			return false, err
+		}
+		i.Instance = id.Reservations[0].Instances[0]
+		if i.Instance.State != nil {
+			switch i.Instance.State.Name {
+			case types.InstanceStateNameShuttingDown, types.InstanceStateNameTerminated:
+				return false, fmt.Errorf("ec2 instance %s is %s", instanceID, i.Instance.State.Name)
+			}
+		}
+		return i.Instance.PublicIpAddress != nil, nil
+	})
+	if err != nil {
+		return i, err
+	}
+	fmt.Fprintln(b.out, "done.")
+
+	// cloud-init prints the host keys it generated on first boot, the only
+	// copy we can trust of what the tunnel should connect to
+	fmt.Fprintf(b.out, "Reading host keys of ec2 instance %s...", instanceID)
+	err = b.poll(ctx, "host keys of ec2 instance "+instanceID, 5*time.Second, ec2WaitLimit, func(ctx context.Context) (bool, error) {
+		co, err := b.ec2.GetConsoleOutput(ctx, &ec2.GetConsoleOutputInput{
+			InstanceId: aws.String(instanceID),
+		})
+		if err != nil || co.Output == nil {
+			return false, err
+		}
+		console, err := base64.StdEncoding.DecodeString(aws.ToString(co.Output))
+		if err != nil {
+			return false, err
+		}
+		i.HostKeys = hostKeyFingerprints(string(console))
+		return len(i.HostKeys) > 0, nil
+	})
+	if err != nil {
+		return i, err
+	}
+	fmt.Fprintln(b.out, "done.")
+
+	return i, nil
+}
+
+// hostKeyFingerprints returns the SHA256 fingerprints cloud-init printed
+// to the console, e.g. "256 SHA256:... root@host (ED25519)".
+func hostKeyFingerprints(console string) []string {
+	var fingerprints []string
+
+	inBlock := false
+	for _, line := range strings.Split(console, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.Contains(line, "-----BEGIN SSH HOST KEY FINGERPRINTS-----"):
+			inBlock = true
+		case strings.Contains(line, "-----END SSH HOST KEY FINGERPRINTS-----"):
+			inBlock = false
+		case inBlock:
+			for _, f := range strings.Fields(line) {
+				if strings.HasPrefix(f, "SHA256:") {
+					fingerprints = append(fingerprints, f)
+				}
+			}
+		}
+	}
+
+	return fingerprints
+}
+
+// proxyImage picks the proxy's AMI: --proxy-ami, the one held in the
+// --proxy-ami-parameter SSM parameter, or the latest Ubuntu 20.04 for the
+// instance type's architecture.
+func (b *backend) proxyImage(ctx context.Context) (string, error) {
+	arch, err := b.architecture(ctx, proxyInstanceType)
+	if err != nil {
+		return "", err
+	}
+
+	ami := proxyAMI
+	if len(proxyAMIParameter) > 0 {
+		ami, err = b.imageParameter(ctx, proxyAMIParameter)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if len(ami) > 0 {
+		img, err := b.ec2.DescribeImages(ctx, &ec2.DescribeImagesInput{
+			ImageIds: []string{ami},
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(img.Images) == 0 {
+			return "", fmt.Errorf("proxy AMI %s not found", ami)
+		}
+		if a := string(img.Images[0].Architecture); a != arch {
+			return "", fmt.Errorf("proxy AMI %s is %s but %s instances are %s", ami, a, proxyInstanceType, arch)
+		}
+		return ami, nil
+	}
+
+	img, err := b.ec2.DescribeImages(ctx, &ec2.DescribeImagesInput{
 		Filters: []types.Filter{
 			{
 				Name:   aws.String("name"),
@@ -181,7 +364,7 @@ func createProxy(ctx context.Context, groupID string) (ec2Instance, error) {
 			},
 			{
 				Name:   aws.String("architecture"),
-				Values: []string{"arm64"},
+				Values: []string{arch},
 			},
 			{
 				Name:   aws.String("virtualization-type"),
@@ -191,7 +374,10 @@ func createProxy(ctx context.Context, groupID string) (ec2Instance, error) {
 		Owners: []string{"099720109477"},
 	})
 	if err != nil {
-		return i, err
+		return "", err
+	}
+	if len(img.Images) == 0 {
+		return "", fmt.Errorf("no Ubuntu 20.04 %s AMI found, set --proxy-ami or --proxy-ami-parameter", arch)
 	}
 
 	sort.Slice(img.Images, func(i, j int) bool {
@@ -200,75 +386,154 @@ func createProxy(ctx context.Context, groupID string) (ec2Instance, error) {
 		return it.Before(jt)
 	})
 
-	iout, err := client.RunInstances(ctx, &ec2.RunInstancesInput{
-		MaxCount:     aws.Int32(1),
-		MinCount:     aws.Int32(1),
-		ImageId:      img.Images[len(img.Images)-1].ImageId,
-		InstanceType: types.InstanceTypeT4gNano,
-		KeyName:      k.KeyName,
-		NetworkInterfaces: []types.InstanceNetworkInterfaceSpecification{
-			{
-				AssociatePublicIpAddress: aws.Bool(true),
-				DeleteOnTermination:      aws.Bool(true),
-				DeviceIndex:              aws.Int32(0),
-				Groups:                   []string{groupID},
-				SubnetId:                 aws.String(proxySubnet),
-			},
-		},
+	return aws.ToString(img.Images[len(img.Images)-1].ImageId), nil
+}
+
+// imageParameter returns the AMI ID held in the SSM parameter name.
+func (b *backend) imageParameter(ctx context.Context, name string) (string, error) {
+	output, err := b.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+		Name: aws.String(name),
 	})
 	if err != nil {
-		return i, err
+		return "", err
 	}
+	if output.Parameter == nil || len(aws.ToString(output.Parameter.Value)) == 0 {
+		return "", fmt.Errorf("SSM parameter %s holds no AMI", name)
+	}
+	return aws.ToString(output.Parameter.Value), nil
+}
 
-	instanceID := aws.ToString(iout.Instances[0].InstanceId)
-	fmt.Printf("Creating ec2 instance %s...", instanceID)
+// architecture returns the AMI architecture, arm64 or x86_64, that
+// instanceType runs.
+func (b *backend) architecture(ctx context.Context, instanceType string) (string, error) {
+	it, err := b.ec2.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []types.InstanceType{types.InstanceType(instanceType)},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(it.InstanceTypes) == 0 || it.InstanceTypes[0].ProcessorInfo == nil {
+		return "", fmt.Errorf("unknown instance type %s", instanceType)
+	}
 
-	for {
-		time.Sleep(1 * time.Second)
-		id, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+	for _, a := range it.InstanceTypes[0].ProcessorInfo.SupportedArchitectures {
+		if a == types.ArchitectureTypeArm64 || a == types.ArchitectureTypeX8664 {
+			return string(a), nil
+		}
+	}
+	return "", fmt.Errorf("instance type %s supports neither arm64 nor x86_64", instanceType)
+}
+
+func (b *backend) deleteProxy(ctx context.Context, instanceID string) error {
+	fmt.Fprintf(b.out, "Terminating ec2 instance %s...", instanceID)
+	_, err := b.ec2.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if isEC2Error(err, "InvalidInstanceID.NotFound") {
+		fmt.Fprintln(b.out, "done.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// must be terminated to delete security group
+	err = b.poll(ctx, "ec2 instance "+instanceID+" termination", 1*time.Second, ec2WaitLimit, func(ctx context.Context) (bool, error) {
+		output, err := b.ec2.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
 			InstanceIds: []string{instanceID},
 		})
+		if isEC2Error(err, "InvalidInstanceID.NotFound") {
+			return true, nil
+		}
 		if err != nil {
-			return i, err
+			return false, err
 		}
-		if len(id.Reservations) > 0 && id.Reservations[0].Instances[0].PublicIpAddress != nil {
-			fmt.Println("done.")
-			i.Instance = id.Reservations[0].Instances[0]
-			break
+		if len(output.Reservations) == 0 || len(output.Reservations[0].Instances) == 0 {
+			return true, nil
 		}
-		fmt.Print(".")
+		s := output.Reservations[0].Instances[0].State
+		return s != nil && s.Name == types.InstanceStateNameTerminated, nil
+	})
+	if err != nil {
+		return err
 	}
+	fmt.Fprintln(b.out, "done.")
 
-	return i, nil
+	return nil
 }
 
-func deleteProxy(ctx context.Context, instanceID string) error {
-	client, err := ec2Client(ctx)
-	if err != nil {
-		return err
+// findExpiredEC2 returns tagged proxies, keypairs and security groups that
+// have outlived their TTL.
+func (b *backend) findExpiredEC2(ctx context.Context, now time.Time) ([]resource, error) {
+	var res []resource
+
+	tagFilter := types.Filter{
+		Name:   aws.String("tag-key"),
+		Values: []string{tagRunID},
 	}
 
-	t, err := client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
-		InstanceIds: []string{instanceID},
+	iin := &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			tagFilter,
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped"},
+			},
+		},
+	}
+	for {
+		iout, err := b.ec2.DescribeInstances(ctx, iin)
+		if err != nil {
+			return res, err
+		}
+		for _, rv := range iout.Reservations {
+			for _, v := range rv.Instances {
+				r, ok := taggedResource(kindProxy, aws.ToString(v.InstanceId), ec2TagMap(v.Tags), now)
+				if ok {
+					res = append(res, r)
+				}
+			}
+		}
+		// handle pagination
+		if iout.NextToken == nil {
+			break
+		}
+		iin.NextToken = iout.NextToken
+	}
+
+	kout, err := b.ec2.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{
+		Filters: []types.Filter{tagFilter},
 	})
 	if err != nil {
-		return err
+		return res, err
+	}
+	for _, v := range kout.KeyPairs {
+		r, ok := taggedResource(kindKeypair, aws.ToString(v.KeyPairId), ec2TagMap(v.Tags), now)
+		if ok {
+			res = append(res, r)
+		}
 	}
 
-	fmt.Printf("Terminating ec2 instance %s...", instanceID)
-
-	// must be terminated to delete security group
-	for t.TerminatingInstances[0].CurrentState.Name != "terminated" {
-		time.Sleep(1 * time.Second)
-		t, err = client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
-			InstanceIds: []string{instanceID},
-		})
+	gin := &ec2.DescribeSecurityGroupsInput{
+		Filters: []types.Filter{tagFilter},
+	}
+	for {
+		gout, err := b.ec2.DescribeSecurityGroups(ctx, gin)
 		if err != nil {
-			return err
+			return res, err
+		}
+		for _, v := range gout.SecurityGroups {
+			r, ok := taggedResource(kindSecurityGroup, aws.ToString(v.GroupId), ec2TagMap(v.Tags), now)
+			if ok {
+				res = append(res, r)
+			}
 		}
-		fmt.Print(".")
+		// handle pagination
+		if gout.NextToken == nil {
+			break
+		}
+		gin.NextToken = gout.NextToken
 	}
-	fmt.Println("done.")
 
-	return nil
+	return res, nil
 }
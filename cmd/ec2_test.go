@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestProxyImage(t *testing.T) {
+	tests := []struct {
+		ami, parameter, instanceType string
+		want, err                    string
+	}{
+		{instanceType: "t4g.nano", want: "ami-00000000000000002"},
+		{instanceType: "t3.micro", want: "ami-00000000000000004"},
+		{ami: "ami-00000000000000001", instanceType: "t4g.nano", want: "ami-00000000000000001"},
+		{ami: "ami-00000000000000003", instanceType: "t4g.nano", err: "is x86_64 but t4g.nano instances are arm64"},
+		{parameter: "/fake/ami/arm64", instanceType: "t4g.nano", want: "ami-00000000000000002"},
+		{parameter: "/fake/ami/x86_64", instanceType: "t3.micro", want: "ami-00000000000000004"},
+		{parameter: "/fake/ami/x86_64", instanceType: "t4g.nano", err: "is x86_64 but t4g.nano instances are arm64"},
+		{parameter: "/fake/ami/missing", instanceType: "t4g.nano", err: "ParameterNotFound"},
+	}
+	for _, tt := range tests {
+		setGlobal(t, &proxyAMI, tt.ami)
+		setGlobal(t, &proxyAMIParameter, tt.parameter)
+		setGlobal(t, &proxyInstanceType, tt.instanceType)
+		b, _ := newFakeBackend()
+
+		got, err := b.proxyImage(context.Background())
+		switch {
+		case len(tt.err) > 0 && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%+v: got %q, %v, want an error containing %q", tt, got, err, tt.err)
+		case len(tt.err) == 0 && (err != nil || got != tt.want):
+			t.Errorf("%+v: got %q, %v, want %s", tt, got, err, tt.want)
+		}
+	}
+}
+
+func TestCreateProxyWhileEC2CatchesUp(t *testing.T) {
+	setGlobal(t, &proxySubnet, "subnet-1")
+	b, f := newFakeBackend()
+	f.lag = 2
+	l := newTestLedger(t, b)
+	ctx := context.Background()
+
+	g, err := b.createSecurityGroup(ctx, "vpc-1", "proxy", l)
+	if err != nil {
+		t.Fatalf("creating security group: %v", err)
+	}
+	p, err := b.createProxy(ctx, aws.ToString(g.GroupId), l)
+	if err != nil {
+		t.Fatalf("creating proxy: %v", err)
+	}
+	if p.Instance.PublicIpAddress == nil || len(p.HostKeys) == 0 {
+		t.Errorf("proxy %+v not ready", p.Instance)
+	}
+}
@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"io/ioutil"
-	"os"
 	"os/exec"
+	"time"
 )
 
 func getScripts(dir string) ([]fs.FileInfo, error) {
@@ -16,29 +19,38 @@ func getScripts(dir string) ([]fs.FileInfo, error) {
 	return scripts, nil
 }
 
-func runScripts(dir string, vars []envVar) error {
-	fmt.Printf("Executing scripts in %s...\n", dir)
+// runScripts executes every script in dir, returning how long each took.
+func runScripts(ctx context.Context, stdout, stderr io.Writer, dir string, vars []envVar) ([]phase, error) {
+	var phases []phase
+
+	fmt.Fprintf(stdout, "Executing scripts in %s...\n", dir)
 
 	scripts, err := getScripts(dir)
 	if err != nil {
-		return err
+		return phases, err
 	}
 
 	for k, v := range scripts {
-		fmt.Printf("[%d/%d] Calling %s\n", k+1, len(scripts), v.Name())
-		cmd := exec.Command(dir + "/" + v.Name())
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		fmt.Fprintf(stdout, "[%d/%d] Calling %s\n", k+1, len(scripts), v.Name())
+		cmd := exec.CommandContext(ctx, dir+"/"+v.Name())
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
 		if vars != nil {
 			for _, vv := range vars {
 				cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", vv.Key, vv.Value))
 			}
 		}
+		start := time.Now()
 		err := cmd.Run()
+		phases = append(phases, timed("script "+dir+"/"+v.Name(), start))
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			return phases, fmt.Errorf("%w: %s: %v", errCheckFailed, v.Name(), err)
+		}
 		if err != nil {
-			return err
+			return phases, err
 		}
 	}
 
-	return nil
+	return phases, nil
 }
@@ -0,0 +1,1122 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// number of polls a fake resource spends in a transitional state
+	fakeSteps = 2
+	// records per page returned by paginated describe calls
+	fakePageSize = 4
+
+	fakeRegion        = "us-east-1"
+	fakeAccount       = "000000000000"
+	fakeSourceAccount = "111111111111"
+)
+
+// fakeAWS is an in-memory stand-in for RDS, EC2 and SSM. Resources move through
+// the same transitional states as the real services (creating -> available,
+// deleting -> gone, pending -> running, shutting-down -> terminated) as they
+// are polled, so whole runs can be exercised offline.
+type fakeAWS struct {
+	mu sync.Mutex
+
+	clusters         map[string]*rdstypes.DBCluster
+	instances        map[string]*rdstypes.DBInstance
+	clusterSnapshots []rdstypes.DBClusterSnapshot
+	snapshots        []rdstypes.DBSnapshot
+
+	keypairs map[string]*ec2types.KeyPairInfo
+	groups   map[string]*ec2types.SecurityGroup
+	hosts    map[string]*ec2types.Instance
+
+	ticks  map[string]int
+	copies map[string]bool     // snapshot copies still being made
+	shares map[string][]string // accounts each snapshot is shared with
+
+	deleted       []string                 // "kind id" of every deletion started, in order
+	removedGroups []ec2types.SecurityGroup // as they were when deleted
+	terminations  int                      // TerminateInstances calls
+
+	// where proxies are reached and the host key fingerprint they print,
+	// when set, so runs can tunnel to a local sshd
+	hostIP          string
+	hostFingerprint string
+
+	// status databases being created and snapshots being copied end up in
+	// instead of available, when set
+	failStatus string
+
+	// describes new key pairs, security groups and instances go unseen by,
+	// as EC2 is eventually consistent
+	lag    int
+	unseen map[string]int
+}
+
+// newFakeBackend returns a backend on a freshly seeded fakeAWS whose polls
+// never wait.
+func newFakeBackend() (*backend, *fakeAWS) {
+	f := newFakeAWS()
+	b := &backend{
+		rds:      f,
+		ec2:      f,
+		ssm:      f,
+		sleep:    func(ctx context.Context, _ time.Duration) error { return ctx.Err() },
+		egressIP: func(context.Context) (string, error) { return "192.0.2.10", nil },
+		out:      io.Discard,
+		errOut:   io.Discard,
+		region:   fakeRegion,
+		account:  fakeAccount,
+	}
+	return b, f
+}
+
+// withFakeSource gives b a source backend on the same fakeAWS, in account.
+func withFakeSource(b *backend, account string) {
+	src := *b
+	src.source = true
+	src.account = account
+	b.src = &src
+}
+
+// finished returns the status a database or snapshot copy settles in.
+func (f *fakeAWS) finished() string {
+	if len(f.failStatus) > 0 {
+		return f.failStatus
+	}
+	return "available"
+}
+
+// seen reports whether a describe finds a new EC2 resource yet.
+func (f *fakeAWS) seen(id string) bool {
+	if f.unseen[id] > 0 {
+		f.unseen[id]--
+		return false
+	}
+	return true
+}
+
+func (f *fakeAWS) deletions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.deleted...)
+}
+
+func newFakeAWS() *fakeAWS {
+	f := &fakeAWS{
+		clusters:  make(map[string]*rdstypes.DBCluster),
+		instances: make(map[string]*rdstypes.DBInstance),
+		keypairs:  make(map[string]*ec2types.KeyPairInfo),
+		groups:    make(map[string]*ec2types.SecurityGroup),
+		hosts:     make(map[string]*ec2types.Instance),
+		ticks:     make(map[string]int),
+		copies:    make(map[string]bool),
+		shares:    make(map[string][]string),
+		unseen:    make(map[string]int),
+	}
+
+	// seed a cluster and a standalone instance, each with a few snapshots
+	f.clusters["demo-cluster"] = &rdstypes.DBCluster{
+		BackupRetentionPeriod: aws.Int32(7),
+		DBClusterIdentifier:   aws.String("demo-cluster"),
+		Engine:                aws.String("aurora-postgresql"),
+		Status:                aws.String("available"),
+		DBClusterMembers: []rdstypes.DBClusterMember{
+			{DBInstanceIdentifier: aws.String("demo-cluster-1"), IsClusterWriter: true},
+		},
+	}
+	f.instances["demo-cluster-1"] = f.newInstance("demo-cluster-1", "aurora-postgresql", "available")
+	f.instances["demo-cluster-1"].DBClusterIdentifier = aws.String("demo-cluster")
+	f.instances["demo-db"] = f.newInstance("demo-db", "postgres", "available")
+	f.instances["demo-db"].BackupRetentionPeriod = 7
+
+	now := time.Now().UTC()
+	f.clusters["demo-cluster"].EarliestRestorableTime = aws.Time(now.Add(-7 * 24 * time.Hour))
+	f.clusters["demo-cluster"].LatestRestorableTime = aws.Time(now.Add(-5 * time.Minute))
+	f.instances["demo-db"].LatestRestorableTime = aws.Time(now.Add(-5 * time.Minute))
+
+	// the newest snapshot of each is still being taken
+	for i := 0; i <= 10; i++ {
+		kind := "automated"
+		if i%5 == 0 {
+			kind = "manual"
+		}
+		status, progress := "available", int32(100)
+		if i == 0 {
+			status, progress = "creating", 40
+		}
+		created := now.Add(-time.Duration(i*24) * time.Hour)
+		f.clusterSnapshots = append(f.clusterSnapshots, rdstypes.DBClusterSnapshot{
+			DBClusterIdentifier:         aws.String("demo-cluster"),
+			DBClusterSnapshotIdentifier: aws.String(fmt.Sprintf("rds:demo-cluster-%d", i)),
+			DBClusterSnapshotArn:        aws.String(fmt.Sprintf("arn:aws:rds:us-east-1:000000000000:cluster-snapshot:rds:demo-cluster-%d", i)),
+			Engine:                      aws.String("aurora-postgresql"),
+			SnapshotCreateTime:          aws.Time(created),
+			PercentProgress:             progress,
+			StorageEncrypted:            true,
+			SnapshotType:                aws.String(kind),
+			Status:                      aws.String(status),
+		})
+		f.snapshots = append(f.snapshots, rdstypes.DBSnapshot{
+			DBInstanceIdentifier:       aws.String("demo-db"),
+			DBSnapshotIdentifier:       aws.String(fmt.Sprintf("rds:demo-db-%d", i)),
+			DBSnapshotArn:              aws.String(fmt.Sprintf("arn:aws:rds:us-east-1:000000000000:snapshot:rds:demo-db-%d", i)),
+			Engine:                     aws.String("postgres"),
+			SnapshotCreateTime:         aws.Time(created),
+			OriginalSnapshotCreateTime: aws.Time(created),
+			Encrypted:                  true,
+			PercentProgress:            progress,
+			SnapshotType:               aws.String(kind),
+			Status:                     aws.String(status),
+		})
+	}
+
+	return f
+}
+
+func (f *fakeAWS) newInstance(id, engine, status string) *rdstypes.DBInstance {
+	return &rdstypes.DBInstance{
+		DBInstanceIdentifier: aws.String(id),
+		DBInstanceStatus:     aws.String(status),
+		DBName:               aws.String("postgres"),
+		Engine:               aws.String(engine),
+		MasterUsername:       aws.String("postgres"),
+		Endpoint: &rdstypes.Endpoint{
+			Address: aws.String(id + ".fake.rds.amazonaws.com"),
+			Port:    5432,
+		},
+	}
+}
+
+// step reports whether id has been polled enough to reach its next state.
+func (f *fakeAWS) step(id string) bool {
+	f.ticks[id]++
+	if f.ticks[id] < fakeSteps {
+		return false
+	}
+	delete(f.ticks, id)
+	return true
+}
+
+func (f *fakeAWS) advanceCluster(id string) {
+	c, ok := f.clusters[id]
+	if !ok {
+		return
+	}
+	switch aws.ToString(c.Status) {
+	case "creating":
+		if f.step(id) {
+			c.Status = aws.String(f.finished())
+		}
+	case "deleting":
+		if f.step(id) {
+			delete(f.clusters, id)
+		}
+	}
+}
+
+func (f *fakeAWS) advanceInstance(id string) {
+	i, ok := f.instances[id]
+	if !ok {
+		return
+	}
+	switch aws.ToString(i.DBInstanceStatus) {
+	case "creating":
+		if f.step(id) {
+			i.DBInstanceStatus = aws.String(f.finished())
+		}
+	case "deleting":
+		if f.step(id) {
+			delete(f.instances, id)
+			if c, ok := f.clusters[aws.ToString(i.DBClusterIdentifier)]; ok {
+				var members []rdstypes.DBClusterMember
+				for _, m := range c.DBClusterMembers {
+					if aws.ToString(m.DBInstanceIdentifier) != id {
+						members = append(members, m)
+					}
+				}
+				c.DBClusterMembers = members
+			}
+		}
+	}
+}
+
+func (f *fakeAWS) advanceHost(id string) {
+	h, ok := f.hosts[id]
+	if !ok {
+		return
+	}
+	switch h.State.Name {
+	case ec2types.InstanceStateNamePending:
+		if f.step(id) {
+			h.State = &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}
+			h.PublicIpAddress = aws.String(fmt.Sprintf("192.0.2.%d", len(f.hosts)))
+			if len(f.hostIP) > 0 {
+				h.PublicIpAddress = aws.String(f.hostIP)
+			}
+		}
+	case ec2types.InstanceStateNameShuttingDown:
+		if f.step(id) {
+			h.State = &ec2types.InstanceState{Name: ec2types.InstanceStateNameTerminated}
+		}
+	}
+}
+
+// fakePage returns the bounds of the page starting at marker and the marker
+// for the next page, if any.
+func fakePage(n int, marker *string) (int, int, *string) {
+	start, _ := strconv.Atoi(aws.ToString(marker))
+	if start > n {
+		start = n
+	}
+	end := start + fakePageSize
+	if end >= n {
+		return start, n, nil
+	}
+	return start, end, aws.String(strconv.Itoa(end))
+}
+
+func fakeAPIError(code, format string, args ...interface{}) error {
+	return &smithy.GenericAPIError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func fakeTagsFromSpecs(specs []ec2types.TagSpecification, rt ec2types.ResourceType) []ec2types.Tag {
+	for _, s := range specs {
+		if s.ResourceType == rt {
+			return s.Tags
+		}
+	}
+	return nil
+}
+
+// fakeMatchFilters implements the small subset of EC2 filters we use.
+func fakeMatchFilters(filters []ec2types.Filter, tags []ec2types.Tag, state ec2types.InstanceStateName) bool {
+	for _, fl := range filters {
+		switch aws.ToString(fl.Name) {
+		case "tag-key":
+			m := ec2TagMap(tags)
+			found := false
+			for _, v := range fl.Values {
+				if _, ok := m[v]; ok {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		case "instance-state-name":
+			found := false
+			for _, v := range fl.Values {
+				if v == string(state) {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// RDS
+
+func (f *fakeAWS) DescribeDBClusters(ctx context.Context, in *rds.DescribeDBClustersInput, _ ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &rds.DescribeDBClustersOutput{}
+	if in.DBClusterIdentifier != nil {
+		id := aws.ToString(in.DBClusterIdentifier)
+		f.advanceCluster(id)
+		c, ok := f.clusters[id]
+		if !ok {
+			return nil, &rdstypes.DBClusterNotFoundFault{Message: aws.String("DBCluster " + id + " not found.")}
+		}
+		out.DBClusters = append(out.DBClusters, *c)
+		return out, nil
+	}
+
+	for _, c := range f.clusters {
+		out.DBClusters = append(out.DBClusters, *c)
+	}
+	return out, nil
+}
+
+func (f *fakeAWS) DescribeDBInstances(ctx context.Context, in *rds.DescribeDBInstancesInput, _ ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &rds.DescribeDBInstancesOutput{}
+	if in.DBInstanceIdentifier != nil {
+		id := aws.ToString(in.DBInstanceIdentifier)
+		f.advanceInstance(id)
+		i, ok := f.instances[id]
+		if !ok {
+			return nil, &rdstypes.DBInstanceNotFoundFault{Message: aws.String("DBInstance " + id + " not found.")}
+		}
+		out.DBInstances = append(out.DBInstances, *i)
+		return out, nil
+	}
+
+	for _, i := range f.instances {
+		out.DBInstances = append(out.DBInstances, *i)
+	}
+	return out, nil
+}
+
+func (f *fakeAWS) DescribeDBClusterSnapshots(ctx context.Context, in *rds.DescribeDBClusterSnapshotsInput, _ ...func(*rds.Options)) (*rds.DescribeDBClusterSnapshotsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, s := range f.clusterSnapshots {
+		id := aws.ToString(s.DBClusterSnapshotIdentifier)
+		if f.copies[id] && f.step(id) {
+			f.clusterSnapshots[i].Status = aws.String(f.finished())
+			f.clusterSnapshots[i].PercentProgress = 100
+			delete(f.copies, id)
+		}
+	}
+
+	out := &rds.DescribeDBClusterSnapshotsOutput{}
+	for _, s := range f.clusterSnapshots {
+		if in.DBClusterIdentifier != nil && aws.ToString(in.DBClusterIdentifier) != aws.ToString(s.DBClusterIdentifier) {
+			continue
+		}
+		if in.DBClusterSnapshotIdentifier != nil && aws.ToString(in.DBClusterSnapshotIdentifier) != aws.ToString(s.DBClusterSnapshotIdentifier) {
+			continue
+		}
+		if in.SnapshotType != nil && aws.ToString(in.SnapshotType) != aws.ToString(s.SnapshotType) {
+			continue
+		}
+		out.DBClusterSnapshots = append(out.DBClusterSnapshots, s)
+	}
+	if in.DBClusterSnapshotIdentifier != nil && len(out.DBClusterSnapshots) == 0 {
+		return nil, &rdstypes.DBClusterSnapshotNotFoundFault{Message: aws.String("DBClusterSnapshot " + aws.ToString(in.DBClusterSnapshotIdentifier) + " not found.")}
+	}
+	start, end, next := fakePage(len(out.DBClusterSnapshots), in.Marker)
+	out.DBClusterSnapshots = out.DBClusterSnapshots[start:end]
+	out.Marker = next
+	return out, nil
+}
+
+func (f *fakeAWS) DescribeDBSnapshots(ctx context.Context, in *rds.DescribeDBSnapshotsInput, _ ...func(*rds.Options)) (*rds.DescribeDBSnapshotsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, s := range f.snapshots {
+		id := aws.ToString(s.DBSnapshotIdentifier)
+		if f.copies[id] && f.step(id) {
+			f.snapshots[i].Status = aws.String(f.finished())
+			f.snapshots[i].PercentProgress = 100
+			delete(f.copies, id)
+		}
+	}
+
+	out := &rds.DescribeDBSnapshotsOutput{}
+	for _, s := range f.snapshots {
+		if in.DBInstanceIdentifier != nil && aws.ToString(in.DBInstanceIdentifier) != aws.ToString(s.DBInstanceIdentifier) {
+			continue
+		}
+		if in.DBSnapshotIdentifier != nil && aws.ToString(in.DBSnapshotIdentifier) != aws.ToString(s.DBSnapshotIdentifier) {
+			continue
+		}
+		if in.SnapshotType != nil && aws.ToString(in.SnapshotType) != aws.ToString(s.SnapshotType) {
+			continue
+		}
+		out.DBSnapshots = append(out.DBSnapshots, s)
+	}
+	if in.DBSnapshotIdentifier != nil && len(out.DBSnapshots) == 0 {
+		return nil, &rdstypes.DBSnapshotNotFoundFault{Message: aws.String("DBSnapshot " + aws.ToString(in.DBSnapshotIdentifier) + " not found.")}
+	}
+	start, end, next := fakePage(len(out.DBSnapshots), in.Marker)
+	out.DBSnapshots = out.DBSnapshots[start:end]
+	out.Marker = next
+	return out, nil
+}
+
+func (f *fakeAWS) RestoreDBClusterFromSnapshot(ctx context.Context, in *rds.RestoreDBClusterFromSnapshotInput, _ ...func(*rds.Options)) (*rds.RestoreDBClusterFromSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.DBClusterIdentifier)
+	if _, ok := f.clusters[id]; ok {
+		return nil, &rdstypes.DBClusterAlreadyExistsFault{Message: aws.String("DBCluster " + id + " already exists.")}
+	}
+	c := &rdstypes.DBCluster{
+		DBClusterIdentifier: aws.String(id),
+		Engine:              in.Engine,
+		Status:              aws.String("creating"),
+		TagList:             in.Tags,
+	}
+	f.clusters[id] = c
+
+	return &rds.RestoreDBClusterFromSnapshotOutput{DBCluster: c}, nil
+}
+
+func (f *fakeAWS) RestoreDBInstanceFromDBSnapshot(ctx context.Context, in *rds.RestoreDBInstanceFromDBSnapshotInput, _ ...func(*rds.Options)) (*rds.RestoreDBInstanceFromDBSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.DBInstanceIdentifier)
+	if _, ok := f.instances[id]; ok {
+		return nil, &rdstypes.DBInstanceAlreadyExistsFault{Message: aws.String("DBInstance " + id + " already exists.")}
+	}
+	i := f.newInstance(id, aws.ToString(in.Engine), "creating")
+	i.TagList = in.Tags
+	for _, g := range in.VpcSecurityGroupIds {
+		i.VpcSecurityGroups = append(i.VpcSecurityGroups, rdstypes.VpcSecurityGroupMembership{VpcSecurityGroupId: aws.String(g)})
+	}
+	f.instances[id] = i
+
+	return &rds.RestoreDBInstanceFromDBSnapshotOutput{DBInstance: i}, nil
+}
+
+func (f *fakeAWS) RestoreDBClusterToPointInTime(ctx context.Context, in *rds.RestoreDBClusterToPointInTimeInput, _ ...func(*rds.Options)) (*rds.RestoreDBClusterToPointInTimeOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	source, ok := f.clusters[aws.ToString(in.SourceDBClusterIdentifier)]
+	if !ok {
+		return nil, &rdstypes.DBClusterNotFoundFault{Message: aws.String("DBCluster " + aws.ToString(in.SourceDBClusterIdentifier) + " not found.")}
+	}
+	id := aws.ToString(in.DBClusterIdentifier)
+	if _, ok := f.clusters[id]; ok {
+		return nil, &rdstypes.DBClusterAlreadyExistsFault{Message: aws.String("DBCluster " + id + " already exists.")}
+	}
+	if !in.UseLatestRestorableTime && aws.ToTime(in.RestoreToTime).After(aws.ToTime(source.LatestRestorableTime)) {
+		return nil, &rdstypes.InvalidRestoreFault{Message: aws.String("Restore time is after the latest restorable time.")}
+	}
+	c := &rdstypes.DBCluster{
+		DBClusterIdentifier: aws.String(id),
+		Engine:              source.Engine,
+		Status:              aws.String("creating"),
+		TagList:             in.Tags,
+	}
+	f.clusters[id] = c
+
+	return &rds.RestoreDBClusterToPointInTimeOutput{DBCluster: c}, nil
+}
+
+func (f *fakeAWS) RestoreDBInstanceToPointInTime(ctx context.Context, in *rds.RestoreDBInstanceToPointInTimeInput, _ ...func(*rds.Options)) (*rds.RestoreDBInstanceToPointInTimeOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	source, ok := f.instances[aws.ToString(in.SourceDBInstanceIdentifier)]
+	if !ok {
+		return nil, &rdstypes.DBInstanceNotFoundFault{Message: aws.String("DBInstance " + aws.ToString(in.SourceDBInstanceIdentifier) + " not found.")}
+	}
+	id := aws.ToString(in.TargetDBInstanceIdentifier)
+	if _, ok := f.instances[id]; ok {
+		return nil, &rdstypes.DBInstanceAlreadyExistsFault{Message: aws.String("DBInstance " + id + " already exists.")}
+	}
+	if !in.UseLatestRestorableTime && aws.ToTime(in.RestoreTime).After(aws.ToTime(source.LatestRestorableTime)) {
+		return nil, &rdstypes.InvalidRestoreFault{Message: aws.String("Restore time is after the latest restorable time.")}
+	}
+	// instances don't report their earliest restorable time, but RDS
+	// still refuses to go back further than their retention period
+	retention := time.Duration(source.BackupRetentionPeriod) * 24 * time.Hour
+	if !in.UseLatestRestorableTime && aws.ToTime(in.RestoreTime).Before(time.Now().Add(-retention)) {
+		return nil, &rdstypes.InvalidRestoreFault{Message: aws.String("Restore time is before the earliest restorable time.")}
+	}
+	i := f.newInstance(id, aws.ToString(source.Engine), "creating")
+	i.TagList = in.Tags
+	for _, g := range in.VpcSecurityGroupIds {
+		i.VpcSecurityGroups = append(i.VpcSecurityGroups, rdstypes.VpcSecurityGroupMembership{VpcSecurityGroupId: aws.String(g)})
+	}
+	f.instances[id] = i
+
+	return &rds.RestoreDBInstanceToPointInTimeOutput{DBInstance: i}, nil
+}
+
+func (f *fakeAWS) CreateDBInstance(ctx context.Context, in *rds.CreateDBInstanceInput, _ ...func(*rds.Options)) (*rds.CreateDBInstanceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.DBInstanceIdentifier)
+	if _, ok := f.instances[id]; ok {
+		return nil, &rdstypes.DBInstanceAlreadyExistsFault{Message: aws.String("DBInstance " + id + " already exists.")}
+	}
+	i := f.newInstance(id, aws.ToString(in.Engine), "creating")
+	i.TagList = in.Tags
+	for _, g := range in.VpcSecurityGroupIds {
+		i.VpcSecurityGroups = append(i.VpcSecurityGroups, rdstypes.VpcSecurityGroupMembership{VpcSecurityGroupId: aws.String(g)})
+	}
+
+	if in.DBClusterIdentifier != nil {
+		// cluster members take the cluster's groups
+		if len(in.VpcSecurityGroupIds) > 0 {
+			return nil, fakeAPIError("InvalidParameterCombination", "The requested DB Instance will be a member of a DB Cluster. Set VPC security group for the DB Cluster.")
+		}
+		c, ok := f.clusters[aws.ToString(in.DBClusterIdentifier)]
+		if !ok {
+			return nil, &rdstypes.DBClusterNotFoundFault{Message: aws.String("DBCluster " + aws.ToString(in.DBClusterIdentifier) + " not found.")}
+		}
+		i.DBClusterIdentifier = in.DBClusterIdentifier
+		i.VpcSecurityGroups = c.VpcSecurityGroups
+		c.DBClusterMembers = append(c.DBClusterMembers, rdstypes.DBClusterMember{
+			DBInstanceIdentifier: aws.String(id),
+			IsClusterWriter:      len(c.DBClusterMembers) == 0,
+		})
+	}
+	f.instances[id] = i
+
+	return &rds.CreateDBInstanceOutput{DBInstance: i}, nil
+}
+
+func (f *fakeAWS) DeleteDBInstance(ctx context.Context, in *rds.DeleteDBInstanceInput, _ ...func(*rds.Options)) (*rds.DeleteDBInstanceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.DBInstanceIdentifier)
+	i, ok := f.instances[id]
+	if !ok {
+		return nil, &rdstypes.DBInstanceNotFoundFault{Message: aws.String("DBInstance " + id + " not found.")}
+	}
+	if aws.ToString(i.DBInstanceStatus) == "deleting" {
+		return nil, &rdstypes.InvalidDBInstanceStateFault{Message: aws.String("Instance " + id + " is already being deleted.")}
+	}
+	i.DBInstanceStatus = aws.String("deleting")
+	f.deleted = append(f.deleted, kindDBInstance+" "+id)
+
+	return &rds.DeleteDBInstanceOutput{DBInstance: i}, nil
+}
+
+func (f *fakeAWS) DeleteDBCluster(ctx context.Context, in *rds.DeleteDBClusterInput, _ ...func(*rds.Options)) (*rds.DeleteDBClusterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.DBClusterIdentifier)
+	c, ok := f.clusters[id]
+	if !ok {
+		return nil, &rdstypes.DBClusterNotFoundFault{Message: aws.String("DBCluster " + id + " not found.")}
+	}
+	if len(c.DBClusterMembers) > 0 {
+		return nil, &rdstypes.InvalidDBClusterStateFault{Message: aws.String("Cluster " + id + " still has member instances.")}
+	}
+	c.Status = aws.String("deleting")
+	f.deleted = append(f.deleted, kindDBCluster+" "+id)
+
+	return &rds.DeleteDBClusterOutput{DBCluster: c}, nil
+}
+
+func (f *fakeAWS) CopyDBClusterSnapshot(ctx context.Context, in *rds.CopyDBClusterSnapshotInput, _ ...func(*rds.Options)) (*rds.CopyDBClusterSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	source := aws.ToString(in.SourceDBClusterSnapshotIdentifier)
+	for _, s := range f.clusterSnapshots {
+		if aws.ToString(s.DBClusterSnapshotArn) != source && aws.ToString(s.DBClusterSnapshotIdentifier) != source {
+			continue
+		}
+		id := aws.ToString(in.TargetDBClusterSnapshotIdentifier)
+		s.DBClusterSnapshotIdentifier = aws.String(id)
+		s.DBClusterSnapshotArn = aws.String("arn:aws:rds:us-west-2:000000000000:cluster-snapshot:" + id)
+		s.KmsKeyId = in.KmsKeyId
+		s.PercentProgress = 0
+		s.SnapshotCreateTime = aws.Time(time.Now().UTC())
+		s.SnapshotType = aws.String("manual")
+		s.Status = aws.String("creating")
+		s.TagList = in.Tags
+		f.clusterSnapshots = append(f.clusterSnapshots, s)
+		f.copies[id] = true
+
+		return &rds.CopyDBClusterSnapshotOutput{DBClusterSnapshot: &s}, nil
+	}
+
+	return nil, &rdstypes.DBClusterSnapshotNotFoundFault{Message: aws.String("DBClusterSnapshot " + source + " not found.")}
+}
+
+func (f *fakeAWS) CopyDBSnapshot(ctx context.Context, in *rds.CopyDBSnapshotInput, _ ...func(*rds.Options)) (*rds.CopyDBSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	source := aws.ToString(in.SourceDBSnapshotIdentifier)
+	for _, s := range f.snapshots {
+		if aws.ToString(s.DBSnapshotArn) != source && aws.ToString(s.DBSnapshotIdentifier) != source {
+			continue
+		}
+		id := aws.ToString(in.TargetDBSnapshotIdentifier)
+		s.DBSnapshotIdentifier = aws.String(id)
+		s.DBSnapshotArn = aws.String("arn:aws:rds:us-west-2:000000000000:snapshot:" + id)
+		// copies keep when the original was taken
+		if s.OriginalSnapshotCreateTime == nil {
+			s.OriginalSnapshotCreateTime = s.SnapshotCreateTime
+		}
+		s.KmsKeyId = in.KmsKeyId
+		s.PercentProgress = 0
+		s.SnapshotCreateTime = aws.Time(time.Now().UTC())
+		s.SnapshotType = aws.String("manual")
+		s.Status = aws.String("creating")
+		s.TagList = in.Tags
+		f.snapshots = append(f.snapshots, s)
+		f.copies[id] = true
+
+		return &rds.CopyDBSnapshotOutput{DBSnapshot: &s}, nil
+	}
+
+	return nil, &rdstypes.DBSnapshotNotFoundFault{Message: aws.String("DBSnapshot " + source + " not found.")}
+}
+
+func (f *fakeAWS) DeleteDBClusterSnapshot(ctx context.Context, in *rds.DeleteDBClusterSnapshotInput, _ ...func(*rds.Options)) (*rds.DeleteDBClusterSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.DBClusterSnapshotIdentifier)
+	for i, s := range f.clusterSnapshots {
+		if aws.ToString(s.DBClusterSnapshotIdentifier) == id {
+			f.clusterSnapshots = append(f.clusterSnapshots[:i], f.clusterSnapshots[i+1:]...)
+			delete(f.shares, id)
+			f.deleted = append(f.deleted, kindDBClusterSnapshot+" "+id)
+			return &rds.DeleteDBClusterSnapshotOutput{DBClusterSnapshot: &s}, nil
+		}
+	}
+
+	return nil, &rdstypes.DBClusterSnapshotNotFoundFault{Message: aws.String("DBClusterSnapshot " + id + " not found.")}
+}
+
+func (f *fakeAWS) DeleteDBSnapshot(ctx context.Context, in *rds.DeleteDBSnapshotInput, _ ...func(*rds.Options)) (*rds.DeleteDBSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.DBSnapshotIdentifier)
+	for i, s := range f.snapshots {
+		if aws.ToString(s.DBSnapshotIdentifier) == id {
+			f.snapshots = append(f.snapshots[:i], f.snapshots[i+1:]...)
+			delete(f.shares, id)
+			f.deleted = append(f.deleted, kindDBSnapshot+" "+id)
+			return &rds.DeleteDBSnapshotOutput{DBSnapshot: &s}, nil
+		}
+	}
+
+	return nil, &rdstypes.DBSnapshotNotFoundFault{Message: aws.String("DBSnapshot " + id + " not found.")}
+}
+
+func (f *fakeAWS) ModifyDBClusterSnapshotAttribute(ctx context.Context, in *rds.ModifyDBClusterSnapshotAttributeInput, _ ...func(*rds.Options)) (*rds.ModifyDBClusterSnapshotAttributeOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.DBClusterSnapshotIdentifier)
+	for _, s := range f.clusterSnapshots {
+		if aws.ToString(s.DBClusterSnapshotIdentifier) != id {
+			continue
+		}
+		if aws.ToString(s.SnapshotType) == "automated" {
+			return nil, &rdstypes.InvalidDBClusterSnapshotStateFault{Message: aws.String("Automated snapshots cannot be shared.")}
+		}
+		f.shares[id] = append(f.shares[id], in.ValuesToAdd...)
+		return &rds.ModifyDBClusterSnapshotAttributeOutput{}, nil
+	}
+
+	return nil, &rdstypes.DBClusterSnapshotNotFoundFault{Message: aws.String("DBClusterSnapshot " + id + " not found.")}
+}
+
+func (f *fakeAWS) ModifyDBSnapshotAttribute(ctx context.Context, in *rds.ModifyDBSnapshotAttributeInput, _ ...func(*rds.Options)) (*rds.ModifyDBSnapshotAttributeOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.DBSnapshotIdentifier)
+	for _, s := range f.snapshots {
+		if aws.ToString(s.DBSnapshotIdentifier) != id {
+			continue
+		}
+		if aws.ToString(s.SnapshotType) == "automated" {
+			return nil, &rdstypes.InvalidDBSnapshotStateFault{Message: aws.String("Automated snapshots cannot be shared.")}
+		}
+		f.shares[id] = append(f.shares[id], in.ValuesToAdd...)
+		return &rds.ModifyDBSnapshotAttributeOutput{}, nil
+	}
+
+	return nil, &rdstypes.DBSnapshotNotFoundFault{Message: aws.String("DBSnapshot " + id + " not found.")}
+}
+
+// EC2
+
+func (f *fakeAWS) ImportKeyPair(ctx context.Context, in *ec2.ImportKeyPairInput, _ ...func(*ec2.Options)) (*ec2.ImportKeyPairOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(in.PublicKeyMaterial)
+	if err != nil {
+		return nil, fakeAPIError("InvalidKey.Format", "Key is not in valid OpenSSH public key format")
+	}
+
+	id := "key-" + strings.ToLower(randomString(17))
+	f.keypairs[id] = &ec2types.KeyPairInfo{
+		KeyName:        in.KeyName,
+		KeyPairId:      aws.String(id),
+		KeyType:        ec2types.KeyTypeEd25519,
+		KeyFingerprint: aws.String(ssh.FingerprintSHA256(pub)),
+		Tags:           fakeTagsFromSpecs(in.TagSpecifications, ec2types.ResourceTypeKeyPair),
+	}
+	f.unseen[aws.ToString(in.KeyName)] = f.lag
+
+	return &ec2.ImportKeyPairOutput{
+		KeyName:        in.KeyName,
+		KeyPairId:      aws.String(id),
+		KeyFingerprint: aws.String(ssh.FingerprintSHA256(pub)),
+	}, nil
+}
+
+func (f *fakeAWS) DescribeKeyPairs(ctx context.Context, in *ec2.DescribeKeyPairsInput, _ ...func(*ec2.Options)) (*ec2.DescribeKeyPairsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, name := range in.KeyNames {
+		found := false
+		for _, k := range f.keypairs {
+			found = found || aws.ToString(k.KeyName) == name
+		}
+		if !found || !f.seen(name) {
+			return nil, fakeAPIError("InvalidKeyPair.NotFound", "The key pair '%s' does not exist", name)
+		}
+	}
+
+	out := &ec2.DescribeKeyPairsOutput{}
+	for _, k := range f.keypairs {
+		if len(in.KeyNames) > 0 && !contains(in.KeyNames, aws.ToString(k.KeyName)) {
+			continue
+		}
+		if !fakeMatchFilters(in.Filters, k.Tags, "") {
+			continue
+		}
+		out.KeyPairs = append(out.KeyPairs, *k)
+	}
+	return out, nil
+}
+
+func (f *fakeAWS) DeleteKeyPair(ctx context.Context, in *ec2.DeleteKeyPairInput, _ ...func(*ec2.Options)) (*ec2.DeleteKeyPairOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.KeyPairId)
+	if _, ok := f.keypairs[id]; !ok {
+		return nil, fakeAPIError("InvalidKeyPair.NotFound", "The key pair '%s' does not exist", id)
+	}
+	delete(f.keypairs, id)
+	f.deleted = append(f.deleted, kindKeypair+" "+id)
+	return &ec2.DeleteKeyPairOutput{}, nil
+}
+
+func (f *fakeAWS) CreateSecurityGroup(ctx context.Context, in *ec2.CreateSecurityGroupInput, _ ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := "sg-" + strings.ToLower(randomString(17))
+	f.groups[id] = &ec2types.SecurityGroup{
+		GroupId:             aws.String(id),
+		GroupName:           in.GroupName,
+		Description:         in.Description,
+		VpcId:               in.VpcId,
+		IpPermissionsEgress: []ec2types.IpPermission{{IpProtocol: aws.String("-1")}},
+		Tags:                fakeTagsFromSpecs(in.TagSpecifications, ec2types.ResourceTypeSecurityGroup),
+	}
+	f.unseen[id] = f.lag
+
+	return &ec2.CreateSecurityGroupOutput{GroupId: aws.String(id)}, nil
+}
+
+func (f *fakeAWS) DescribeSecurityGroups(ctx context.Context, in *ec2.DescribeSecurityGroupsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &ec2.DescribeSecurityGroupsOutput{}
+	for _, id := range in.GroupIds {
+		if _, ok := f.groups[id]; !ok || !f.seen(id) {
+			return nil, fakeAPIError("InvalidGroup.NotFound", "The security group '%s' does not exist", id)
+		}
+	}
+	for id, g := range f.groups {
+		if len(in.GroupIds) > 0 && !contains(in.GroupIds, id) {
+			continue
+		}
+		if !fakeMatchFilters(in.Filters, g.Tags, "") {
+			continue
+		}
+		out.SecurityGroups = append(out.SecurityGroups, *g)
+	}
+	return out, nil
+}
+
+func (f *fakeAWS) AuthorizeSecurityGroupIngress(ctx context.Context, in *ec2.AuthorizeSecurityGroupIngressInput, _ ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	g, ok := f.groups[aws.ToString(in.GroupId)]
+	if !ok {
+		return nil, fakeAPIError("InvalidGroup.NotFound", "The security group '%s' does not exist", aws.ToString(in.GroupId))
+	}
+	if in.SourceSecurityGroupName != nil {
+		return nil, fakeAPIError("InvalidParameterValue", "Security groups in a VPC must be referenced by ID")
+	}
+	for _, p := range in.IpPermissions {
+		for _, pair := range p.UserIdGroupPairs {
+			if _, ok := f.groups[aws.ToString(pair.GroupId)]; !ok {
+				return nil, fakeAPIError("InvalidGroup.NotFound", "The security group '%s' does not exist", aws.ToString(pair.GroupId))
+			}
+		}
+	}
+
+	if in.CidrIp != nil {
+		g.IpPermissions = append(g.IpPermissions, ec2types.IpPermission{
+			FromPort:   in.FromPort,
+			ToPort:     in.ToPort,
+			IpProtocol: in.IpProtocol,
+			IpRanges:   []ec2types.IpRange{{CidrIp: in.CidrIp}},
+		})
+	}
+	g.IpPermissions = append(g.IpPermissions, in.IpPermissions...)
+
+	return &ec2.AuthorizeSecurityGroupIngressOutput{Return: aws.Bool(true)}, nil
+}
+
+func (f *fakeAWS) DeleteSecurityGroup(ctx context.Context, in *ec2.DeleteSecurityGroupInput, _ ...func(*ec2.Options)) (*ec2.DeleteSecurityGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.GroupId)
+	if _, ok := f.groups[id]; !ok {
+		return nil, fakeAPIError("InvalidGroup.NotFound", "The security group '%s' does not exist", id)
+	}
+
+	// like EC2, refuse while anything still references the group
+	for _, h := range f.hosts {
+		if h.State.Name == ec2types.InstanceStateNameTerminated {
+			continue
+		}
+		for _, g := range h.SecurityGroups {
+			if aws.ToString(g.GroupId) == id {
+				return nil, fakeAPIError("DependencyViolation", "resource %s has a dependent object", id)
+			}
+		}
+	}
+	for _, i := range f.instances {
+		for _, g := range i.VpcSecurityGroups {
+			if aws.ToString(g.VpcSecurityGroupId) == id {
+				return nil, fakeAPIError("DependencyViolation", "resource %s has a dependent object", id)
+			}
+		}
+	}
+	for _, c := range f.clusters {
+		for _, g := range c.VpcSecurityGroups {
+			if aws.ToString(g.VpcSecurityGroupId) == id {
+				return nil, fakeAPIError("DependencyViolation", "resource %s has a dependent object", id)
+			}
+		}
+	}
+	for _, g := range f.groups {
+		for _, p := range g.IpPermissions {
+			for _, pair := range p.UserIdGroupPairs {
+				if aws.ToString(pair.GroupId) == id {
+					return nil, fakeAPIError("DependencyViolation", "resource %s has a dependent object", id)
+				}
+			}
+		}
+	}
+
+	f.removedGroups = append(f.removedGroups, *f.groups[id])
+	delete(f.groups, id)
+	f.deleted = append(f.deleted, kindSecurityGroup+" "+id)
+	return &ec2.DeleteSecurityGroupOutput{}, nil
+}
+
+// fakeImages stand in for Ubuntu's AMIs, one old and one new per
+// architecture.
+var fakeImages = []ec2types.Image{
+	{ImageId: aws.String("ami-00000000000000001"), Architecture: ec2types.ArchitectureValuesArm64, CreationDate: aws.String("2022-01-01T00:00:00.000Z")},
+	{ImageId: aws.String("ami-00000000000000002"), Architecture: ec2types.ArchitectureValuesArm64, CreationDate: aws.String("2022-06-01T00:00:00.000Z")},
+	{ImageId: aws.String("ami-00000000000000003"), Architecture: ec2types.ArchitectureValuesX8664, CreationDate: aws.String("2022-01-01T00:00:00.000Z")},
+	{ImageId: aws.String("ami-00000000000000004"), Architecture: ec2types.ArchitectureValuesX8664, CreationDate: aws.String("2022-06-01T00:00:00.000Z")},
+}
+
+// fakeImageParameters stand in for the public SSM parameters that hold the
+// latest AMI of each architecture.
+var fakeImageParameters = map[string]string{
+	"/fake/ami/arm64":  "ami-00000000000000002",
+	"/fake/ami/x86_64": "ami-00000000000000004",
+}
+
+func (f *fakeAWS) GetParameter(ctx context.Context, in *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	name := aws.ToString(in.Name)
+	v, ok := fakeImageParameters[name]
+	if !ok {
+		return nil, &ssmtypes.ParameterNotFound{}
+	}
+	return &ssm.GetParameterOutput{
+		Parameter: &ssmtypes.Parameter{Name: in.Name, Type: ssmtypes.ParameterTypeString, Value: aws.String(v)},
+	}, nil
+}
+
+// DescribeImages only honours image IDs and the architecture filter.
+func (f *fakeAWS) DescribeImages(ctx context.Context, in *ec2.DescribeImagesInput, _ ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	var arch []string
+	for _, v := range in.Filters {
+		if aws.ToString(v.Name) == "architecture" {
+			arch = v.Values
+		}
+	}
+
+	out := &ec2.DescribeImagesOutput{}
+	for _, img := range fakeImages {
+		if len(in.ImageIds) > 0 && !contains(in.ImageIds, aws.ToString(img.ImageId)) {
+			continue
+		}
+		if arch != nil && !contains(arch, string(img.Architecture)) {
+			continue
+		}
+		out.Images = append(out.Images, img)
+	}
+	return out, nil
+}
+
+// DescribeInstanceTypes treats Graviton families, those with a "g" after
+// the generation such as t4g or c7gn, as arm64 and the rest as x86_64.
+func (f *fakeAWS) DescribeInstanceTypes(ctx context.Context, in *ec2.DescribeInstanceTypesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	out := &ec2.DescribeInstanceTypesOutput{}
+	for _, t := range in.InstanceTypes {
+		family, _, ok := strings.Cut(string(t), ".")
+		if !ok {
+			return nil, fakeAPIError("InvalidInstanceType", "The following supplied instance types do not exist: [%s]", t)
+		}
+
+		arch := []ec2types.ArchitectureType{ec2types.ArchitectureTypeI386, ec2types.ArchitectureTypeX8664}
+		if n := strings.IndexAny(family, "0123456789"); n >= 0 && strings.HasPrefix(family[n+1:], "g") {
+			arch = []ec2types.ArchitectureType{ec2types.ArchitectureTypeArm64}
+		}
+		out.InstanceTypes = append(out.InstanceTypes, ec2types.InstanceTypeInfo{
+			InstanceType:  t,
+			ProcessorInfo: &ec2types.ProcessorInfo{SupportedArchitectures: arch},
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeAWS) RunInstances(ctx context.Context, in *ec2.RunInstancesInput, _ ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := "i-" + strings.ToLower(randomString(17))
+	h := &ec2types.Instance{
+		InstanceId:   aws.String(id),
+		ImageId:      in.ImageId,
+		InstanceType: in.InstanceType,
+		KeyName:      in.KeyName,
+		State:        &ec2types.InstanceState{Name: ec2types.InstanceStateNamePending},
+		Tags:         fakeTagsFromSpecs(in.TagSpecifications, ec2types.ResourceTypeInstance),
+	}
+	for _, n := range in.NetworkInterfaces {
+		h.SubnetId = n.SubnetId
+		for _, g := range n.Groups {
+			h.SecurityGroups = append(h.SecurityGroups, ec2types.GroupIdentifier{GroupId: aws.String(g)})
+		}
+	}
+	for _, g := range in.SecurityGroupIds {
+		h.SecurityGroups = append(h.SecurityGroups, ec2types.GroupIdentifier{GroupId: aws.String(g)})
+	}
+	f.hosts[id] = h
+	f.unseen[id] = f.lag
+
+	return &ec2.RunInstancesOutput{Instances: []ec2types.Instance{*h}}, nil
+}
+
+func (f *fakeAWS) DescribeInstances(ctx context.Context, in *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, id := range in.InstanceIds {
+		if _, ok := f.hosts[id]; !ok || !f.seen(id) {
+			return nil, fakeAPIError("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+		}
+	}
+
+	out := &ec2.DescribeInstancesOutput{}
+	for id, h := range f.hosts {
+		if len(in.InstanceIds) > 0 && !contains(in.InstanceIds, id) {
+			continue
+		}
+		f.advanceHost(id)
+		if !fakeMatchFilters(in.Filters, h.Tags, h.State.Name) {
+			continue
+		}
+		out.Reservations = append(out.Reservations, ec2types.Reservation{
+			Instances: []ec2types.Instance{*h},
+		})
+	}
+	return out, nil
+}
+
+// GetConsoleOutput prints cloud-init's host key fingerprints once the
+// instance is running, derived from its ID since there is no real host.
+func (f *fakeAWS) GetConsoleOutput(ctx context.Context, in *ec2.GetConsoleOutputInput, _ ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.ToString(in.InstanceId)
+	h, ok := f.hosts[id]
+	if !ok {
+		return nil, fakeAPIError("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+	}
+
+	out := &ec2.GetConsoleOutputOutput{InstanceId: in.InstanceId}
+	if h.State.Name != ec2types.InstanceStateNameRunning {
+		return out, nil
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	fingerprint := "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+	if len(f.hostFingerprint) > 0 {
+		fingerprint = f.hostFingerprint
+	}
+	console := "-----BEGIN SSH HOST KEY FINGERPRINTS-----\n" +
+		"ec2: 256 " + fingerprint + " root@" + id + " (ED25519)\n" +
+		"-----END SSH HOST KEY FINGERPRINTS-----\n"
+	out.Output = aws.String(base64.StdEncoding.EncodeToString([]byte(console)))
+
+	return out, nil
+}
+
+func (f *fakeAWS) TerminateInstances(ctx context.Context, in *ec2.TerminateInstancesInput, _ ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.terminations++
+	out := &ec2.TerminateInstancesOutput{}
+	for _, id := range in.InstanceIds {
+		h, ok := f.hosts[id]
+		if !ok {
+			return nil, fakeAPIError("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+		}
+		prev := *h.State
+		if h.State.Name == ec2types.InstanceStateNamePending || h.State.Name == ec2types.InstanceStateNameRunning {
+			h.State = &ec2types.InstanceState{Name: ec2types.InstanceStateNameShuttingDown}
+			f.deleted = append(f.deleted, kindProxy+" "+id)
+		} else {
+			f.advanceHost(id)
+		}
+		out.TerminatingInstances = append(out.TerminatingInstances, ec2types.InstanceStateChange{
+			InstanceId:    aws.String(id),
+			PreviousState: &prev,
+			CurrentState:  h.State,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var gcYes = false
+
+// deletion order for orphans; dependents first
+var gcOrder = map[string]int{
+	kindDBInstance:        0,
+	kindDBCluster:         1,
+	kindDBClusterSnapshot: 2,
+	kindDBSnapshot:        2,
+	kindProxy:             3,
+	kindKeypair:           4,
+	kindSecurityGroup:     5,
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Find and delete tagged resources that have outlived their TTL",
+	Run:   runGC,
+}
+
+func init() {
+	gcCmd.Flags().BoolVar(&gcYes, "yes", gcYes, "delete without asking for confirmation")
+	rootCmd.AddCommand(gcCmd)
+}
+
+func runGC(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	now := time.Now()
+
+	b, err := newBackend(ctx)
+	if err != nil {
+		fatal(exitError, err)
+	}
+
+	expired, err := b.findExpired(ctx, now)
+	if err != nil {
+		fatal(exitError, err)
+	}
+	if len(expired) == 0 {
+		fmt.Println("No expired resources found.")
+		return
+	}
+
+	for _, r := range expired {
+		fmt.Printf("%-16s %-40s run %s, created %s\n", r.Kind, r.ID, r.RunID, r.Created.Format(time.RFC3339))
+	}
+
+	if !gcYes && !confirm(fmt.Sprintf("Delete %d resources?", len(expired))) {
+		return
+	}
+
+	errs := b.deleteAll(ctx, expired, func(resource) {})
+	if len(errs) > 0 {
+		fmt.Printf("%d resources could not be deleted:\n", len(errs))
+		for _, err := range errs {
+			fmt.Printf("  %v\n", err)
+		}
+		os.Exit(exitCleanup)
+	}
+}
+
+// findExpired lists every tagged resource past its TTL at now, in the order
+// they can be deleted.
+func (b *backend) findExpired(ctx context.Context, now time.Time) ([]resource, error) {
+	dbs, err := b.findExpiredRDS(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := b.findExpiredEC2(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	if b.crossAccount() {
+		copies, err := b.src.findExpiredRDS(ctx, now)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range copies {
+			r.Source = true
+			dbs = append(dbs, r)
+		}
+	}
+
+	expired := append(dbs, hosts...)
+	sort.SliceStable(expired, func(i, j int) bool {
+		return gcOrder[expired[i].Kind] < gcOrder[expired[j].Kind]
+	})
+
+	return expired, nil
+}
+
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
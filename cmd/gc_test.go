@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFindExpired(t *testing.T) {
+	ctx := context.Background()
+	b, f := newFakeBackend()
+	l := newTestLedger(t, b)
+
+	// resources a crashed run left behind
+	_, err := b.createSecurityGroup(ctx, "vpc-1", "proxy", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.createKeypair(ctx, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.copyInstanceSnapshot(ctx, f.snapshots[1], "", "", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	expired, err := b.findExpired(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) > 0 {
+		t.Fatalf("%v expired before their TTL", expired)
+	}
+
+	expired, err = b.findExpired(ctx, now.Add(ttl+time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, r := range expired {
+		kinds = append(kinds, r.Kind)
+		if r.RunID != l.RunID {
+			t.Errorf("%s %s has run ID %q, want %q", r.Kind, r.ID, r.RunID, l.RunID)
+		}
+	}
+	want := []string{kindDBSnapshot, kindKeypair, kindSecurityGroup}
+	if len(kinds) != len(want) {
+		t.Fatalf("found %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("found %v, want %v in deletion order", kinds, want)
+		}
+	}
+
+	if errs := b.deleteAll(ctx, expired, func(resource) {}); len(errs) > 0 {
+		t.Fatalf("deleteAll failed: %v", errs)
+	}
+	expired, err = b.findExpired(ctx, now.Add(ttl+time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) > 0 {
+		t.Errorf("%v still found after deleting", expired)
+	}
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available DB clusters and instances",
+	Run:   runList,
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+}
+
+func runList(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	b, err := newBackend(ctx)
+	if err != nil {
+		fatal(exitError, err)
+	}
+
+	res, err := b.lookup().getDatabases(ctx)
+	if err != nil {
+		fatal(exitError, err)
+	}
+
+	err = printDatabases(res)
+	if err != nil {
+		fatal(exitError, err)
+	}
+}
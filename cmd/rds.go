@@ -5,11 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 	"github.com/aws/aws-sdk-go-v2/service/rds/types"
 )
@@ -17,6 +18,7 @@ import (
 type createDBResult struct {
 	Cluster  types.DBCluster
 	Instance types.DBInstance
+	Phases   []phase
 }
 
 type getDBResult struct {
@@ -40,29 +42,22 @@ type instance struct {
 	Status     string `json:"status,omitempty"`
 }
 
+type snapshot struct {
+	Identifier string `json:"identifier,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Created    string `json:"created,omitempty"`
+}
+
 type dbOutput struct {
 	Clusters  []cluster  `json:"clusters,omitempty"`
 	Instances []instance `json:"instances,omitempty"`
 }
 
-func rdsClient(ctx context.Context) (*rds.Client, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	return rds.NewFromConfig(cfg), nil
-}
-
-func getDatabases(ctx context.Context) (getDBResult, error) {
+func (b *backend) getDatabases(ctx context.Context) (getDBResult, error) {
 	var r getDBResult
 
-	client, err := rdsClient(ctx)
-	if err != nil {
-		return r, err
-	}
-
-	cout, err := client.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
+	cout, err := b.rds.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
 		IncludeShared: true,
 	})
 	if err != nil {
@@ -71,7 +66,7 @@ func getDatabases(ctx context.Context) (getDBResult, error) {
 	r.Clusters = cout.DBClusters
 	// handle pagination
 	for cout.Marker != nil {
-		cout, err = client.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
+		cout, err = b.rds.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
 			IncludeShared: true,
 			Marker:        cout.Marker,
 		})
@@ -81,14 +76,14 @@ func getDatabases(ctx context.Context) (getDBResult, error) {
 		r.Clusters = append(r.Clusters, cout.DBClusters...)
 	}
 
-	iout, err := client.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{})
+	iout, err := b.rds.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{})
 	if err != nil {
 		return r, err
 	}
 	r.Instances = iout.DBInstances
 	// handle pagination
 	for iout.Marker != nil {
-		iout, err = client.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
+		iout, err = b.rds.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
 			Marker: iout.Marker,
 		})
 		if err != nil {
@@ -139,154 +134,572 @@ func printDatabases(r getDBResult) error {
 	return nil
 }
 
-func getClusterSnapshot(ctx context.Context, clusterID string) (types.DBClusterSnapshot, error) {
-	var s types.DBClusterSnapshot
+// printSnapshots takes either cluster or instance snapshots.
+func printSnapshots(clusterSnapshots []types.DBClusterSnapshot, instanceSnapshots []types.DBSnapshot) error {
+	out := []snapshot{}
 
-	client, err := rdsClient(ctx)
+	for _, v := range clusterSnapshots {
+		out = append(out, snapshot{
+			Identifier: aws.ToString(v.DBClusterSnapshotIdentifier),
+			Type:       aws.ToString(v.SnapshotType),
+			Status:     aws.ToString(v.Status),
+			Created:    formatTime(v.SnapshotCreateTime),
+		})
+	}
+	for _, v := range instanceSnapshots {
+		out = append(out, snapshot{
+			Identifier: aws.ToString(v.DBSnapshotIdentifier),
+			Type:       aws.ToString(v.SnapshotType),
+			Status:     aws.ToString(v.Status),
+			Created:    formatTime(v.SnapshotCreateTime),
+		})
+	}
+
+	j, err := json.MarshalIndent(out, "", "  ")
 	if err != nil {
-		return s, err
+		return err
 	}
 
-	output, err := client.DescribeDBClusterSnapshots(ctx, &rds.DescribeDBClusterSnapshotsInput{
+	fmt.Printf("%s\n", j)
+
+	return nil
+}
+
+// snapshot selection strategies
+const (
+	strategyLatest = "latest"
+	strategyRandom = "random"
+)
+
+// listClusterSnapshots returns every snapshot for a cluster, oldest first.
+func (b *backend) listClusterSnapshots(ctx context.Context, clusterID string) ([]types.DBClusterSnapshot, error) {
+	var snapshots []types.DBClusterSnapshot
+
+	input := &rds.DescribeDBClusterSnapshotsInput{
 		DBClusterIdentifier: aws.String(clusterID),
-		MaxRecords:          aws.Int32(20),
+		IncludeShared:       snapshotType == "shared",
+		SnapshotType:        optionalString(snapshotType),
+	}
+	for {
+		output, err := b.rds.DescribeDBClusterSnapshots(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, output.DBClusterSnapshots...)
+		// handle pagination
+		if output.Marker == nil {
+			break
+		}
+		input.Marker = output.Marker
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		// cluster snapshots don't record when a copy's original was taken
+		it := aws.ToTime(snapshots[i].SnapshotCreateTime)
+		jt := aws.ToTime(snapshots[j].SnapshotCreateTime)
+		return it.Before(jt)
 	})
+
+	return snapshots, nil
+}
+
+// getClusterSnapshot picks the snapshot to restore according to
+// --snapshot-id and --snapshot-strategy. It also returns when the newest
+// available snapshot was taken, which is what --max-snapshot-age judges
+// whichever snapshot is restored. Copies made by runs are never picked.
+func (b *backend) getClusterSnapshot(ctx context.Context, clusterID string) (types.DBClusterSnapshot, time.Time, error) {
+	var s types.DBClusterSnapshot
+
+	all, err := b.listClusterSnapshots(ctx, clusterID)
 	if err != nil {
-		return s, err
+		return s, time.Time{}, err
 	}
 
-	if len(output.DBClusterSnapshots) == 0 {
-		return s, errors.New("no snapshots found")
+	var snapshots []types.DBClusterSnapshot
+	for _, v := range all {
+		if runID, ok := rdsTagMap(v.TagList)[tagRunID]; ok {
+			fmt.Fprintf(b.out, "Skipping snapshot %s: copy made by run %s\n", aws.ToString(v.DBClusterSnapshotIdentifier), runID)
+			continue
+		}
+		err = snapshotStatus(aws.ToString(v.DBClusterSnapshotIdentifier), aws.ToString(v.Status), v.PercentProgress)
+		if err != nil {
+			fmt.Fprintf(b.out, "Skipping %v\n", err)
+			continue
+		}
+		snapshots = append(snapshots, v)
 	}
 
-	sort.Slice(output.DBClusterSnapshots, func(i, j int) bool {
-		it := *output.DBClusterSnapshots[i].SnapshotCreateTime
-		jt := *output.DBClusterSnapshots[j].SnapshotCreateTime
-		return it.Before(jt)
+	var newest time.Time
+	if len(snapshots) > 0 {
+		newest = aws.ToTime(snapshots[len(snapshots)-1].SnapshotCreateTime)
+	}
+
+	if len(snapshotID) > 0 {
+		output, err := b.rds.DescribeDBClusterSnapshots(ctx, &rds.DescribeDBClusterSnapshotsInput{
+			DBClusterSnapshotIdentifier: aws.String(snapshotID),
+			IncludeShared:               true,
+		})
+		if err != nil {
+			return s, newest, err
+		}
+		if len(output.DBClusterSnapshots) == 0 {
+			return s, newest, fmt.Errorf("snapshot %s not found", snapshotID)
+		}
+		s = output.DBClusterSnapshots[0]
+		if id := aws.ToString(s.DBClusterIdentifier); id != clusterID {
+			return s, newest, fmt.Errorf("snapshot %s is of cluster %s, not %s", snapshotID, id, clusterID)
+		}
+		if created := aws.ToTime(s.SnapshotCreateTime); created.After(newest) {
+			newest = created
+		}
+		return s, newest, snapshotStatus(snapshotID, aws.ToString(s.Status), s.PercentProgress)
+	}
+
+	if len(snapshots) == 0 {
+		if err != nil {
+			return s, newest, fmt.Errorf("no available snapshots: %w", err)
+		}
+		return s, newest, errors.New("no snapshots found")
+	}
+
+	if snapshotStrategy == strategyRandom {
+		window := snapshotWindow
+		if window == 0 {
+			// snapshots outlive deleted clusters, whose retention is then
+			// unknown
+			var notFound *types.DBClusterNotFoundFault
+			output, err := b.rds.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
+				DBClusterIdentifier: aws.String(clusterID),
+			})
+			if errors.As(err, &notFound) {
+				fmt.Fprintf(b.out, "Cluster %s not found, picking from every snapshot; use --snapshot-window to limit\n", clusterID)
+			} else if err != nil {
+				return s, newest, err
+			} else if len(output.DBClusters) > 0 {
+				window = retentionWindow(aws.ToInt32(output.DBClusters[0].BackupRetentionPeriod))
+			}
+		}
+
+		var created []time.Time
+		for _, v := range snapshots {
+			created = append(created, aws.ToTime(v.SnapshotCreateTime))
+		}
+		i := randomWithin(created, window)
+		if i < 0 {
+			return s, newest, fmt.Errorf("no snapshots within %s", window)
+		}
+		return snapshots[i], newest, nil
+	}
+
+	return snapshots[len(snapshots)-1], newest, nil
+}
+
+// listInstanceSnapshots returns every snapshot for an instance, oldest first.
+func (b *backend) listInstanceSnapshots(ctx context.Context, instanceID string) ([]types.DBSnapshot, error) {
+	var snapshots []types.DBSnapshot
+
+	input := &rds.DescribeDBSnapshotsInput{
+		DBInstanceIdentifier: aws.String(instanceID),
+		IncludeShared:        snapshotType == "shared",
+		SnapshotType:         optionalString(snapshotType),
+	}
+	for {
+		output, err := b.rds.DescribeDBSnapshots(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, output.DBSnapshots...)
+		// handle pagination
+		if output.Marker == nil {
+			break
+		}
+		input.Marker = output.Marker
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshotTaken(snapshots[i]).Before(snapshotTaken(snapshots[j]))
 	})
 
-	return output.DBClusterSnapshots[len(output.DBClusterSnapshots)-1], nil
+	return snapshots, nil
+}
+
+// snapshotTaken returns when the backup in s was taken. Copies get a new
+// SnapshotCreateTime but keep the original's OriginalSnapshotCreateTime.
+func snapshotTaken(s types.DBSnapshot) time.Time {
+	if s.OriginalSnapshotCreateTime != nil {
+		return aws.ToTime(s.OriginalSnapshotCreateTime)
+	}
+	return aws.ToTime(s.SnapshotCreateTime)
 }
 
-func getInstanceSnapshot(ctx context.Context, instanceID string) (types.DBSnapshot, error) {
+// getInstanceSnapshot picks the snapshot to restore according to
+// --snapshot-id and --snapshot-strategy. It also returns when the newest
+// available snapshot was taken, which is what --max-snapshot-age judges
+// whichever snapshot is restored. Copies made by runs are never picked.
+func (b *backend) getInstanceSnapshot(ctx context.Context, instanceID string) (types.DBSnapshot, time.Time, error) {
 	var s types.DBSnapshot
 
-	client, err := rdsClient(ctx)
+	all, err := b.listInstanceSnapshots(ctx, instanceID)
+	if err != nil {
+		return s, time.Time{}, err
+	}
+
+	var snapshots []types.DBSnapshot
+	for _, v := range all {
+		if runID, ok := rdsTagMap(v.TagList)[tagRunID]; ok {
+			fmt.Fprintf(b.out, "Skipping snapshot %s: copy made by run %s\n", aws.ToString(v.DBSnapshotIdentifier), runID)
+			continue
+		}
+		err = snapshotStatus(aws.ToString(v.DBSnapshotIdentifier), aws.ToString(v.Status), v.PercentProgress)
+		if err != nil {
+			fmt.Fprintf(b.out, "Skipping %v\n", err)
+			continue
+		}
+		snapshots = append(snapshots, v)
+	}
+
+	var newest time.Time
+	if len(snapshots) > 0 {
+		newest = snapshotTaken(snapshots[len(snapshots)-1])
+	}
+
+	if len(snapshotID) > 0 {
+		output, err := b.rds.DescribeDBSnapshots(ctx, &rds.DescribeDBSnapshotsInput{
+			DBSnapshotIdentifier: aws.String(snapshotID),
+			IncludeShared:        true,
+		})
+		if err != nil {
+			return s, newest, err
+		}
+		if len(output.DBSnapshots) == 0 {
+			return s, newest, fmt.Errorf("snapshot %s not found", snapshotID)
+		}
+		s = output.DBSnapshots[0]
+		if id := aws.ToString(s.DBInstanceIdentifier); id != instanceID {
+			return s, newest, fmt.Errorf("snapshot %s is of instance %s, not %s", snapshotID, id, instanceID)
+		}
+		if created := snapshotTaken(s); created.After(newest) {
+			newest = created
+		}
+		return s, newest, snapshotStatus(snapshotID, aws.ToString(s.Status), s.PercentProgress)
+	}
+
+	if len(snapshots) == 0 {
+		if err != nil {
+			return s, newest, fmt.Errorf("no available snapshots: %w", err)
+		}
+		return s, newest, errors.New("no snapshots found")
+	}
+
+	if snapshotStrategy == strategyRandom {
+		window := snapshotWindow
+		if window == 0 {
+			// snapshots outlive deleted instances, whose retention is then
+			// unknown
+			var notFound *types.DBInstanceNotFoundFault
+			output, err := b.rds.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
+				DBInstanceIdentifier: aws.String(instanceID),
+			})
+			if errors.As(err, &notFound) {
+				fmt.Fprintf(b.out, "Instance %s not found, picking from every snapshot; use --snapshot-window to limit\n", instanceID)
+			} else if err != nil {
+				return s, newest, err
+			} else if len(output.DBInstances) > 0 {
+				window = retentionWindow(output.DBInstances[0].BackupRetentionPeriod)
+			}
+		}
+
+		var created []time.Time
+		for _, v := range snapshots {
+			created = append(created, snapshotTaken(v))
+		}
+		i := randomWithin(created, window)
+		if i < 0 {
+			return s, newest, fmt.Errorf("no snapshots within %s", window)
+		}
+		return snapshots[i], newest, nil
+	}
+
+	return snapshots[len(snapshots)-1], newest, nil
+}
+
+// snapshotStatus reports why a snapshot can't be restored, if it can't.
+func snapshotStatus(id, status string, progress int32) error {
+	switch status {
+	case "available":
+		return nil
+	case "creating":
+		return fmt.Errorf("snapshot %s: still being created (%d%% complete)", id, progress)
+	default:
+		return fmt.Errorf("snapshot %s: status is %s", id, status)
+	}
+}
+
+// retentionWindow converts a backup retention period in days; zero means
+// no limit.
+func retentionWindow(days int32) time.Duration {
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// randomWithin returns the index of a random entry created within window of
+// now (any entry if window is zero), or -1 if there are none.
+func randomWithin(created []time.Time, window time.Duration) int {
+	var candidates []int
+	for i, t := range created {
+		if window == 0 || time.Since(t) <= window {
+			candidates = append(candidates, i)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return -1
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// copyClusterSnapshot copies snapshot into b's region and account, from
+// sourceRegion if it differs, re-encrypting it with kmsKey if given, and
+// waits for the copy.
+func (b *backend) copyClusterSnapshot(ctx context.Context, snapshot types.DBClusterSnapshot, sourceRegion, kmsKey string, l *ledger) (types.DBClusterSnapshot, error) {
+	var s types.DBClusterSnapshot
+
+	copyID := "rdsvalidator-" + strings.ToLower(randomString(8))
+	fmt.Fprintf(b.out, "Copying cluster snapshot %s to %s...", aws.ToString(snapshot.DBClusterSnapshotIdentifier), copyID)
+
+	_, err := b.rds.CopyDBClusterSnapshot(ctx, &rds.CopyDBClusterSnapshotInput{
+		KmsKeyId:                          optionalString(kmsKey),
+		SourceDBClusterSnapshotIdentifier: snapshot.DBClusterSnapshotArn,
+		SourceRegion:                      optionalString(sourceRegion),
+		Tags:                              rdsTags(l.RunID),
+		TargetDBClusterSnapshotIdentifier: aws.String(copyID),
+	})
+	if err != nil {
+		return s, err
+	}
+	err = b.record(l, kindDBClusterSnapshot, copyID)
 	if err != nil {
 		return s, err
 	}
 
-	output, err := client.DescribeDBSnapshots(ctx, &rds.DescribeDBSnapshotsInput{
-		DBInstanceIdentifier: aws.String(instanceID),
-		MaxRecords:           aws.Int32(20),
+	err = b.poll(ctx, "snapshot "+copyID, 10*time.Second, copyWaitLimit, func(ctx context.Context) (bool, error) {
+		output, err := b.rds.DescribeDBClusterSnapshots(ctx, &rds.DescribeDBClusterSnapshotsInput{
+			DBClusterSnapshotIdentifier: aws.String(copyID),
+		})
+		if err != nil || len(output.DBClusterSnapshots) == 0 {
+			return false, err
+		}
+		s = output.DBClusterSnapshots[0]
+		return aws.ToString(s.Status) == "available", checkStatus("snapshot "+copyID, aws.ToString(s.Status))
 	})
 	if err != nil {
 		return s, err
 	}
+	fmt.Fprintln(b.out, "done.")
+
+	return s, nil
+}
 
-	if len(output.DBSnapshots) == 0 {
-		return s, errors.New("no snapshots found")
+// copyInstanceSnapshot copies snapshot into b's region and account, from
+// sourceRegion if it differs, re-encrypting it with kmsKey if given, and
+// waits for the copy.
+func (b *backend) copyInstanceSnapshot(ctx context.Context, snapshot types.DBSnapshot, sourceRegion, kmsKey string, l *ledger) (types.DBSnapshot, error) {
+	var s types.DBSnapshot
+
+	copyID := "rdsvalidator-" + strings.ToLower(randomString(8))
+	fmt.Fprintf(b.out, "Copying instance snapshot %s to %s...", aws.ToString(snapshot.DBSnapshotIdentifier), copyID)
+
+	_, err := b.rds.CopyDBSnapshot(ctx, &rds.CopyDBSnapshotInput{
+		KmsKeyId:                   optionalString(kmsKey),
+		SourceDBSnapshotIdentifier: snapshot.DBSnapshotArn,
+		SourceRegion:               optionalString(sourceRegion),
+		Tags:                       rdsTags(l.RunID),
+		TargetDBSnapshotIdentifier: aws.String(copyID),
+	})
+	if err != nil {
+		return s, err
+	}
+	err = b.record(l, kindDBSnapshot, copyID)
+	if err != nil {
+		return s, err
 	}
 
-	sort.Slice(output.DBSnapshots, func(i, j int) bool {
-		it := *output.DBSnapshots[i].SnapshotCreateTime
-		jt := *output.DBSnapshots[j].SnapshotCreateTime
-		return it.Before(jt)
+	err = b.poll(ctx, "snapshot "+copyID, 10*time.Second, copyWaitLimit, func(ctx context.Context) (bool, error) {
+		output, err := b.rds.DescribeDBSnapshots(ctx, &rds.DescribeDBSnapshotsInput{
+			DBSnapshotIdentifier: aws.String(copyID),
+		})
+		if err != nil || len(output.DBSnapshots) == 0 {
+			return false, err
+		}
+		s = output.DBSnapshots[0]
+		return aws.ToString(s.Status) == "available", checkStatus("snapshot "+copyID, aws.ToString(s.Status))
 	})
+	if err != nil {
+		return s, err
+	}
+	fmt.Fprintln(b.out, "done.")
 
-	return output.DBSnapshots[len(output.DBSnapshots)-1], nil
+	return s, nil
 }
 
-// https://stackoverflow.com/questions/35709153/disabling-aws-rds-backups-when-creating-updating-instances/35730978#35730978
-func createClusterFromSnapshot(ctx context.Context, snapshot types.DBClusterSnapshot, groupID string) (createDBResult, error) {
-	var r createDBResult
+// shareClusterSnapshot copies snapshot within the source account, since
+// automated snapshots can't be shared, and lets account restore the copy.
+// Deleting the copy revokes access again.
+func (b *backend) shareClusterSnapshot(ctx context.Context, snapshot types.DBClusterSnapshot, account string, l *ledger) (types.DBClusterSnapshot, error) {
+	s, err := b.copyClusterSnapshot(ctx, snapshot, "", sourceKMSKeyID, l)
+	if err != nil {
+		return s, err
+	}
 
-	client, err := rdsClient(ctx)
+	fmt.Fprintf(b.out, "Sharing cluster snapshot %s with account %s...", aws.ToString(s.DBClusterSnapshotIdentifier), account)
+	_, err = b.rds.ModifyDBClusterSnapshotAttribute(ctx, &rds.ModifyDBClusterSnapshotAttributeInput{
+		AttributeName:               aws.String("restore"),
+		DBClusterSnapshotIdentifier: s.DBClusterSnapshotIdentifier,
+		ValuesToAdd:                 []string{account},
+	})
 	if err != nil {
-		return r, err
+		return s, err
+	}
+	fmt.Fprintln(b.out, "done.")
+
+	return s, nil
+}
+
+// shareInstanceSnapshot copies snapshot within the source account, since
+// automated snapshots can't be shared, and lets account restore the copy.
+// Deleting the copy revokes access again.
+func (b *backend) shareInstanceSnapshot(ctx context.Context, snapshot types.DBSnapshot, account string, l *ledger) (types.DBSnapshot, error) {
+	s, err := b.copyInstanceSnapshot(ctx, snapshot, "", sourceKMSKeyID, l)
+	if err != nil {
+		return s, err
+	}
+
+	fmt.Fprintf(b.out, "Sharing instance snapshot %s with account %s...", aws.ToString(s.DBSnapshotIdentifier), account)
+	_, err = b.rds.ModifyDBSnapshotAttribute(ctx, &rds.ModifyDBSnapshotAttributeInput{
+		AttributeName:        aws.String("restore"),
+		DBSnapshotIdentifier: s.DBSnapshotIdentifier,
+		ValuesToAdd:          []string{account},
+	})
+	if err != nil {
+		return s, err
 	}
+	fmt.Fprintln(b.out, "done.")
 
+	return s, nil
+}
+
+// https://stackoverflow.com/questions/35709153/disabling-aws-rds-backups-when-creating-updating-instances/35730978#35730978
+func (b *backend) createClusterFromSnapshot(ctx context.Context, snapshot types.DBClusterSnapshot, groupID string, l *ledger) (createDBResult, error) {
 	clusterID := aws.ToString(snapshot.DBClusterIdentifier) + "-" + randomString(8)
 
-	cout, err := client.RestoreDBClusterFromSnapshot(ctx, &rds.RestoreDBClusterFromSnapshotInput{
+	_, err := b.rds.RestoreDBClusterFromSnapshot(ctx, &rds.RestoreDBClusterFromSnapshotInput{
 		DBClusterIdentifier:    aws.String(clusterID),
 		DBClusterInstanceClass: aws.String(instanceType),
 		Engine:                 snapshot.Engine,
 		PubliclyAccessible:     aws.Bool(false),
 		SnapshotIdentifier:     snapshot.DBClusterSnapshotArn,
-		VpcSecurityGroupIds:    []string{groupID},
+		Tags:                   rdsTags(l.RunID),
+		VpcSecurityGroupIds:    optionalSlice(groupID),
 	})
 	if err != nil {
-		return r, err
+		return createDBResult{}, err
+	}
+	err = l.add(kindDBCluster, clusterID)
+	if err != nil {
+		return createDBResult{}, err
 	}
 
-	fmt.Printf("Waiting on cluster (%s)...", aws.ToString(cout.DBCluster.DBClusterIdentifier))
-	for {
-		time.Sleep(5 * time.Second)
-		output, err := client.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
+	return b.finishCluster(ctx, clusterID, snapshot.Engine, l)
+}
+
+// createClusterToPointInTime restores source as of at, or as of its latest
+// restorable time with --latest-restorable.
+func (b *backend) createClusterToPointInTime(ctx context.Context, source types.DBCluster, at time.Time, groupID string, l *ledger) (createDBResult, error) {
+	clusterID := aws.ToString(source.DBClusterIdentifier) + "-" + randomString(8)
+
+	input := &rds.RestoreDBClusterToPointInTimeInput{
+		DBClusterIdentifier:       aws.String(clusterID),
+		PubliclyAccessible:        aws.Bool(false),
+		SourceDBClusterIdentifier: source.DBClusterIdentifier,
+		Tags:                      rdsTags(l.RunID),
+		VpcSecurityGroupIds:       optionalSlice(groupID),
+	}
+	if latestRestorable {
+		input.UseLatestRestorableTime = true
+	} else {
+		input.RestoreToTime = aws.Time(at)
+	}
+
+	_, err := b.rds.RestoreDBClusterToPointInTime(ctx, input)
+	if err != nil {
+		return createDBResult{}, err
+	}
+	err = l.add(kindDBCluster, clusterID)
+	if err != nil {
+		return createDBResult{}, err
+	}
+
+	return b.finishCluster(ctx, clusterID, source.Engine, l)
+}
+
+// finishCluster waits for a restored cluster to become available, then adds
+// the instance clients connect to. The instance takes the cluster's
+// security groups, as RDS won't set any on cluster members.
+func (b *backend) finishCluster(ctx context.Context, clusterID string, engine *string, l *ledger) (createDBResult, error) {
+	var r createDBResult
+
+	start := time.Now()
+	fmt.Fprintf(b.out, "Waiting on cluster (%s)...", clusterID)
+	err := b.poll(ctx, "cluster "+clusterID, 5*time.Second, dbWaitLimit, func(ctx context.Context) (bool, error) {
+		output, err := b.rds.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
 			DBClusterIdentifier: aws.String(clusterID),
 		})
-		if err != nil {
-			return r, err
-		}
-		if len(output.DBClusters) > 0 {
-			if aws.ToString(output.DBClusters[0].Status) == "available" {
-				fmt.Println("ready!")
-				r.Cluster = output.DBClusters[0]
-				break
-			}
-			fmt.Print(".")
+		if err != nil || len(output.DBClusters) == 0 {
+			return false, err
 		}
+		r.Cluster = output.DBClusters[0]
+		return aws.ToString(r.Cluster.Status) == "available", checkStatus("cluster "+clusterID, aws.ToString(r.Cluster.Status))
+	})
+	if err != nil {
+		return r, err
 	}
+	fmt.Fprintln(b.out, "ready!")
+	r.Phases = append(r.Phases, timed("cluster restore", start))
 
-	iout, err := client.CreateDBInstance(ctx, &rds.CreateDBInstanceInput{
+	memberID := clusterID + "-" + "instance-1"
+	_, err = b.rds.CreateDBInstance(ctx, &rds.CreateDBInstanceInput{
 		AutoMinorVersionUpgrade: aws.Bool(false),
 		BackupRetentionPeriod:   aws.Int32(0),
 		DBClusterIdentifier:     aws.String(clusterID),
 		DBInstanceClass:         aws.String(instanceType),
-		DBInstanceIdentifier:    aws.String(clusterID + "-" + "instance-1"),
-		Engine:                  snapshot.Engine,
+		DBInstanceIdentifier:    aws.String(memberID),
+		Engine:                  engine,
 		Iops:                    aws.Int32(0),
 		MultiAZ:                 aws.Bool(false),
 		PubliclyAccessible:      aws.Bool(false),
-		VpcSecurityGroupIds:     []string{groupID},
+		Tags:                    rdsTags(l.RunID),
 	})
 	if err != nil {
 		return r, err
 	}
-
-	fmt.Printf("Waiting on instance (%s)...", aws.ToString(iout.DBInstance.DBInstanceIdentifier))
-	for {
-		time.Sleep(5 * time.Second)
-		output, err := client.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
-			DBInstanceIdentifier: iout.DBInstance.DBInstanceIdentifier,
-		})
-		if err != nil {
-			return r, err
-		}
-		if aws.ToString(output.DBInstances[0].DBInstanceStatus) == "available" {
-			fmt.Println("ready!")
-			r.Instance = output.DBInstances[0]
-			break
-		}
-		fmt.Print(".")
+	err = l.add(kindDBInstance, memberID)
+	if err != nil {
+		return r, err
 	}
 
-	return r, nil
+	start = time.Now()
+	r.Instance, err = b.waitForInstance(ctx, memberID)
+	r.Phases = append(r.Phases, timed("instance available", start))
+	return r, err
 }
 
 // https://stackoverflow.com/questions/35709153/disabling-aws-rds-backups-when-creating-updating-instances/35730978#35730978
-func createInstanceFromSnapshot(ctx context.Context, snapshot types.DBSnapshot, groupID string) (createDBResult, error) {
+func (b *backend) createInstanceFromSnapshot(ctx context.Context, snapshot types.DBSnapshot, groupID string, l *ledger) (createDBResult, error) {
 	var r createDBResult
 
-	client, err := rdsClient(ctx)
-	if err != nil {
-		return r, err
-	}
-
 	instanceID := aws.ToString(snapshot.DBInstanceIdentifier) + "-" + randomString(8)
 
-	iout, err := client.RestoreDBInstanceFromDBSnapshot(ctx, &rds.RestoreDBInstanceFromDBSnapshotInput{
+	start := time.Now()
+	_, err := b.rds.RestoreDBInstanceFromDBSnapshot(ctx, &rds.RestoreDBInstanceFromDBSnapshotInput{
 		AutoMinorVersionUpgrade: aws.Bool(false),
 		DBInstanceClass:         aws.String(instanceType),
 		DBInstanceIdentifier:    aws.String(instanceID),
@@ -295,57 +708,305 @@ func createInstanceFromSnapshot(ctx context.Context, snapshot types.DBSnapshot,
 		Iops:                    aws.Int32(0),
 		MultiAZ:                 aws.Bool(false),
 		PubliclyAccessible:      aws.Bool(false),
-		VpcSecurityGroupIds:     []string{groupID},
+		Tags:                    rdsTags(l.RunID),
+		VpcSecurityGroupIds:     optionalSlice(groupID),
 	})
 	if err != nil {
 		return r, err
 	}
+	err = l.add(kindDBInstance, instanceID)
+	if err != nil {
+		return r, err
+	}
 
-	fmt.Printf("Waiting on instance (%s)...", aws.ToString(iout.DBInstance.DBInstanceIdentifier))
-	for {
-		time.Sleep(5 * time.Second)
-		output, err := client.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
+	r.Instance, err = b.waitForInstance(ctx, instanceID)
+	r.Phases = append(r.Phases, timed("instance available", start))
+	return r, err
+}
+
+// createInstanceToPointInTime restores source as of at, or as of its latest
+// restorable time with --latest-restorable.
+func (b *backend) createInstanceToPointInTime(ctx context.Context, source types.DBInstance, at time.Time, groupID string, l *ledger) (createDBResult, error) {
+	var r createDBResult
+
+	instanceID := aws.ToString(source.DBInstanceIdentifier) + "-" + randomString(8)
+
+	input := &rds.RestoreDBInstanceToPointInTimeInput{
+		AutoMinorVersionUpgrade:    aws.Bool(false),
+		DBInstanceClass:            aws.String(instanceType),
+		Engine:                     source.Engine,
+		Iops:                       aws.Int32(0),
+		MultiAZ:                    aws.Bool(false),
+		PubliclyAccessible:         aws.Bool(false),
+		SourceDBInstanceIdentifier: source.DBInstanceIdentifier,
+		Tags:                       rdsTags(l.RunID),
+		TargetDBInstanceIdentifier: aws.String(instanceID),
+		VpcSecurityGroupIds:        optionalSlice(groupID),
+	}
+	if latestRestorable {
+		input.UseLatestRestorableTime = true
+	} else {
+		input.RestoreTime = aws.Time(at)
+	}
+
+	start := time.Now()
+	_, err := b.rds.RestoreDBInstanceToPointInTime(ctx, input)
+	if err != nil {
+		return r, err
+	}
+	err = l.add(kindDBInstance, instanceID)
+	if err != nil {
+		return r, err
+	}
+
+	r.Instance, err = b.waitForInstance(ctx, instanceID)
+	r.Phases = append(r.Phases, timed("instance available", start))
+	return r, err
+}
+
+func (b *backend) waitForInstance(ctx context.Context, instanceID string) (types.DBInstance, error) {
+	var i types.DBInstance
+
+	fmt.Fprintf(b.out, "Waiting on instance (%s)...", instanceID)
+	err := b.poll(ctx, "instance "+instanceID, 5*time.Second, dbWaitLimit, func(ctx context.Context) (bool, error) {
+		output, err := b.rds.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
 			DBInstanceIdentifier: aws.String(instanceID),
 		})
-		if err != nil {
-			return r, err
+		if err != nil || len(output.DBInstances) == 0 {
+			return false, err
 		}
-		if aws.ToString(output.DBInstances[0].DBInstanceStatus) == "available" {
-			r.Instance = output.DBInstances[0]
-			fmt.Println("ready!")
-			break
-		}
-		fmt.Print(".")
+		i = output.DBInstances[0]
+		return aws.ToString(i.DBInstanceStatus) == "available", checkStatus("instance "+instanceID, aws.ToString(i.DBInstanceStatus))
+	})
+	if err != nil {
+		return i, err
 	}
+	fmt.Fprintln(b.out, "ready!")
 
-	return r, nil
+	return i, nil
+}
+
+// restorePoint resolves --restore-time or --latest-restorable against a
+// source's restorable window; earliest may be nil when unknown.
+func restorePoint(earliest, latest *time.Time) (time.Time, error) {
+	if latest == nil {
+		return time.Time{}, errors.New("no latest restorable time, are automated backups enabled?")
+	}
+	if latestRestorable {
+		return *latest, nil
+	}
+
+	at, err := time.Parse(time.RFC3339, restoreTime)
+	if err != nil {
+		return at, err
+	}
+	if at.After(*latest) {
+		return at, fmt.Errorf("restore time %s is after the latest restorable time %s", at.Format(time.RFC3339), latest.Format(time.RFC3339))
+	}
+	if earliest != nil && at.Before(*earliest) {
+		return at, fmt.Errorf("restore time %s is before the earliest restorable time %s", at.Format(time.RFC3339), earliest.Format(time.RFC3339))
+	}
+
+	return at, nil
 }
 
-// func deleteDatabaseCluster(ctx context.Context, clusterID, instanceID string) error {
-// 	client, err := rdsClient(ctx)
-// 	if err != nil {
-// 		return err
-// 	}
+// deleteDatabaseCluster removes every member instance, then the cluster
+// itself, waiting until it is gone so dependent security groups can go too.
+func (b *backend) deleteDatabaseCluster(ctx context.Context, clusterID string) error {
+	var notFound *types.DBClusterNotFoundFault
 
-//   client.DeleteDBCluster()
+	output, err := b.rds.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: aws.String(clusterID),
+	})
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(output.DBClusters) == 0 {
+		return nil
+	}
+
+	for _, v := range output.DBClusters[0].DBClusterMembers {
+		err = b.deleteDatabaseInstance(ctx, aws.ToString(v.DBInstanceIdentifier))
+		if err != nil {
+			return err
+		}
+	}
 
-// 	return nil
-// }
+	fmt.Fprintf(b.out, "Deleting database cluster %s...", clusterID)
+	_, err = b.rds.DeleteDBCluster(ctx, &rds.DeleteDBClusterInput{
+		DBClusterIdentifier: aws.String(clusterID),
+		SkipFinalSnapshot:   true,
+	})
+	if errors.As(err, &notFound) {
+		fmt.Fprintln(b.out, "done.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-func deleteDatabaseInstance(ctx context.Context, instanceID string) error {
-	client, err := rdsClient(ctx)
+	err = b.poll(ctx, "cluster "+clusterID+" deletion", 5*time.Second, dbWaitLimit, func(ctx context.Context) (bool, error) {
+		_, err := b.rds.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
+			DBClusterIdentifier: aws.String(clusterID),
+		})
+		if errors.As(err, &notFound) {
+			return true, nil
+		}
+		return false, err
+	})
 	if err != nil {
 		return err
 	}
+	fmt.Fprintln(b.out, "done.")
 
-	_, err = client.DeleteDBInstance(ctx, &rds.DeleteDBInstanceInput{
+	return nil
+}
+
+// deleteDatabaseInstance removes an instance and waits until it is gone. An
+// instance that is already being deleted is simply waited on.
+func (b *backend) deleteDatabaseInstance(ctx context.Context, instanceID string) error {
+	var notFound *types.DBInstanceNotFoundFault
+	var invalidState *types.InvalidDBInstanceStateFault
+
+	fmt.Fprintf(b.out, "Deleting database instance %s...", instanceID)
+	_, err := b.rds.DeleteDBInstance(ctx, &rds.DeleteDBInstanceInput{
 		DBInstanceIdentifier:   aws.String(instanceID),
 		DeleteAutomatedBackups: aws.Bool(true),
 		SkipFinalSnapshot:      true,
 	})
+	if errors.As(err, &notFound) {
+		fmt.Fprintln(b.out, "done.")
+		return nil
+	}
+	if errors.As(err, &invalidState) {
+		output, derr := b.rds.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
+			DBInstanceIdentifier: aws.String(instanceID),
+		})
+		if derr != nil || len(output.DBInstances) == 0 || aws.ToString(output.DBInstances[0].DBInstanceStatus) != "deleting" {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	err = b.poll(ctx, "instance "+instanceID+" deletion", 5*time.Second, dbWaitLimit, func(ctx context.Context) (bool, error) {
+		_, err := b.rds.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
+			DBInstanceIdentifier: aws.String(instanceID),
+		})
+		if errors.As(err, &notFound) {
+			return true, nil
+		}
+		return false, err
+	})
 	if err != nil {
 		return err
 	}
+	fmt.Fprintln(b.out, "done.")
 
 	return nil
 }
+
+func (b *backend) deleteClusterSnapshot(ctx context.Context, snapshotID string) error {
+	var notFound *types.DBClusterSnapshotNotFoundFault
+
+	fmt.Fprintf(b.out, "Deleting cluster snapshot %s...", snapshotID)
+	_, err := b.rds.DeleteDBClusterSnapshot(ctx, &rds.DeleteDBClusterSnapshotInput{
+		DBClusterSnapshotIdentifier: aws.String(snapshotID),
+	})
+	if err != nil && !errors.As(err, &notFound) {
+		return err
+	}
+	fmt.Fprintln(b.out, "done.")
+
+	return nil
+}
+
+func (b *backend) deleteInstanceSnapshot(ctx context.Context, snapshotID string) error {
+	var notFound *types.DBSnapshotNotFoundFault
+
+	fmt.Fprintf(b.out, "Deleting instance snapshot %s...", snapshotID)
+	_, err := b.rds.DeleteDBSnapshot(ctx, &rds.DeleteDBSnapshotInput{
+		DBSnapshotIdentifier: aws.String(snapshotID),
+	})
+	if err != nil && !errors.As(err, &notFound) {
+		return err
+	}
+	fmt.Fprintln(b.out, "done.")
+
+	return nil
+}
+
+// findExpiredRDS returns tagged clusters, instances and snapshot copies that
+// have outlived their TTL.
+func (b *backend) findExpiredRDS(ctx context.Context, now time.Time) ([]resource, error) {
+	var res []resource
+
+	dbs, err := b.getDatabases(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	for _, v := range dbs.Clusters {
+		if aws.ToString(v.Status) == "deleting" {
+			continue
+		}
+		r, ok := taggedResource(kindDBCluster, aws.ToString(v.DBClusterIdentifier), rdsTagMap(v.TagList), now)
+		if ok {
+			res = append(res, r)
+		}
+	}
+
+	for _, v := range dbs.Instances {
+		if aws.ToString(v.DBInstanceStatus) == "deleting" {
+			continue
+		}
+		r, ok := taggedResource(kindDBInstance, aws.ToString(v.DBInstanceIdentifier), rdsTagMap(v.TagList), now)
+		if ok {
+			res = append(res, r)
+		}
+	}
+
+	cinput := &rds.DescribeDBClusterSnapshotsInput{SnapshotType: aws.String("manual")}
+	for {
+		output, err := b.rds.DescribeDBClusterSnapshots(ctx, cinput)
+		if err != nil {
+			return res, err
+		}
+		for _, v := range output.DBClusterSnapshots {
+			r, ok := taggedResource(kindDBClusterSnapshot, aws.ToString(v.DBClusterSnapshotIdentifier), rdsTagMap(v.TagList), now)
+			if ok {
+				res = append(res, r)
+			}
+		}
+		// handle pagination
+		if output.Marker == nil {
+			break
+		}
+		cinput.Marker = output.Marker
+	}
+
+	iinput := &rds.DescribeDBSnapshotsInput{SnapshotType: aws.String("manual")}
+	for {
+		output, err := b.rds.DescribeDBSnapshots(ctx, iinput)
+		if err != nil {
+			return res, err
+		}
+		for _, v := range output.DBSnapshots {
+			r, ok := taggedResource(kindDBSnapshot, aws.ToString(v.DBSnapshotIdentifier), rdsTagMap(v.TagList), now)
+			if ok {
+				res = append(res, r)
+			}
+		}
+		// handle pagination
+		if output.Marker == nil {
+			break
+		}
+		iinput.Marker = output.Marker
+	}
+
+	return res, nil
+}
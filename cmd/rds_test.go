@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+func TestRandomWithin(t *testing.T) {
+	now := time.Now()
+	created := []time.Time{
+		now.Add(-10 * 24 * time.Hour),
+		now.Add(-3 * 24 * time.Hour),
+		now.Add(-36 * time.Hour),
+		now.Add(-time.Hour),
+	}
+	tests := []struct {
+		name      string
+		created   []time.Time
+		retention int32
+		want      []int // every index that may be picked, none for -1
+	}{
+		{name: "window", created: created, retention: 7, want: []int{1, 2, 3}},
+		{name: "short window", created: created, retention: 1, want: []int{3}},
+		{name: "zero retention means any", created: created, retention: 0, want: []int{0, 1, 2, 3}},
+		{name: "none within", created: created[:2], retention: 1},
+		{name: "no snapshots", retention: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := retentionWindow(tt.retention)
+			if want := time.Duration(tt.retention) * 24 * time.Hour; window != want {
+				t.Fatalf("retentionWindow(%d) = %s, want %s", tt.retention, window, want)
+			}
+
+			// random, so pick often enough to see every candidate
+			seen := map[int]bool{}
+			for i := 0; i < 200; i++ {
+				seen[randomWithin(tt.created, window)] = true
+			}
+			if len(tt.want) == 0 {
+				if len(seen) != 1 || !seen[-1] {
+					t.Errorf("picked %v, want only -1", seen)
+				}
+				return
+			}
+			if len(seen) != len(tt.want) {
+				t.Errorf("picked %v, want each of %v", seen, tt.want)
+			}
+			for _, i := range tt.want {
+				if !seen[i] {
+					t.Errorf("never picked %d of %v, picked %v", i, tt.want, seen)
+				}
+			}
+		})
+	}
+}
+
+func TestNoSnapshotsWithinWindow(t *testing.T) {
+	setGlobal(t, &snapshotStrategy, strategyRandom)
+	setGlobal(t, &snapshotWindow, time.Minute)
+	b, _ := newFakeBackend()
+
+	_, _, err := b.getInstanceSnapshot(context.Background(), "demo-db")
+	if err == nil || !strings.Contains(err.Error(), "no snapshots within 1m0s") {
+		t.Errorf("got %v, want no snapshots within the window", err)
+	}
+}
+
+func TestSnapshotIDMustMatchTarget(t *testing.T) {
+	b, f := newFakeBackend()
+	f.clusterSnapshots = append(f.clusterSnapshots, rdstypes.DBClusterSnapshot{
+		DBClusterIdentifier:         aws.String("other-cluster"),
+		DBClusterSnapshotIdentifier: aws.String("rds:other-cluster-0"),
+		SnapshotCreateTime:          aws.Time(time.Now()),
+		Status:                      aws.String("available"),
+	})
+	f.snapshots = append(f.snapshots, rdstypes.DBSnapshot{
+		DBInstanceIdentifier: aws.String("other-db"),
+		DBSnapshotIdentifier: aws.String("rds:other-db-0"),
+		SnapshotCreateTime:   aws.Time(time.Now()),
+		Status:               aws.String("available"),
+	})
+	ctx := context.Background()
+
+	setGlobal(t, &snapshotID, "rds:other-cluster-0")
+	_, _, err := b.getClusterSnapshot(ctx, "demo-cluster")
+	if err == nil || !strings.Contains(err.Error(), "is of cluster other-cluster, not demo-cluster") {
+		t.Errorf("got %v, want the cluster snapshot rejected", err)
+	}
+
+	setGlobal(t, &snapshotID, "rds:other-db-0")
+	_, _, err = b.getInstanceSnapshot(ctx, "demo-db")
+	if err == nil || !strings.Contains(err.Error(), "is of instance other-db, not demo-db") {
+		t.Errorf("got %v, want the instance snapshot rejected", err)
+	}
+
+	setGlobal(t, &snapshotID, "rds:demo-db-1")
+	s, _, err := b.getInstanceSnapshot(ctx, "demo-db")
+	if err != nil || aws.ToString(s.DBSnapshotIdentifier) != "rds:demo-db-1" {
+		t.Errorf("got %s, %v, want rds:demo-db-1", aws.ToString(s.DBSnapshotIdentifier), err)
+	}
+}
+
+func TestSnapshotSelectionSkipsRunCopies(t *testing.T) {
+	b, f := newFakeBackend()
+	l := newTestLedger(t, b)
+	ctx := context.Background()
+
+	// copies left in the source account by other runs, newer than any backup
+	c, err := b.copyClusterSnapshot(ctx, f.clusterSnapshots[1], "", "", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := b.copyInstanceSnapshot(ctx, f.snapshots[1], "", "", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := b.getClusterSnapshot(ctx, "demo-cluster")
+	if err != nil || aws.ToString(got.DBClusterSnapshotIdentifier) != "rds:demo-cluster-1" {
+		t.Errorf("got %s, %v, want rds:demo-cluster-1 rather than copy %s", aws.ToString(got.DBClusterSnapshotIdentifier), err, aws.ToString(c.DBClusterSnapshotIdentifier))
+	}
+
+	setGlobal(t, &snapshotStrategy, strategyRandom)
+	for i := 0; i < 50; i++ {
+		got, _, err := b.getInstanceSnapshot(ctx, "demo-db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := aws.ToString(got.DBSnapshotIdentifier); id == aws.ToString(s.DBSnapshotIdentifier) {
+			t.Fatalf("picked copy %s", id)
+		}
+	}
+}
+
+func TestRandomSnapshotOfDeletedSource(t *testing.T) {
+	setGlobal(t, &snapshotStrategy, strategyRandom)
+	b, f := newFakeBackend()
+	delete(f.clusters, "demo-cluster")
+	delete(f.instances, "demo-db")
+	ctx := context.Background()
+
+	// with no retention to go by, snapshots past it may be picked too
+	seen := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		c, _, err := b.getClusterSnapshot(ctx, "demo-cluster")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, _, err := b.getInstanceSnapshot(ctx, "demo-db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[aws.ToString(c.DBClusterSnapshotIdentifier)] = true
+		seen[aws.ToString(s.DBSnapshotIdentifier)] = true
+	}
+	for _, id := range []string{"rds:demo-cluster-10", "rds:demo-db-10"} {
+		if !seen[id] {
+			t.Errorf("never picked %s, picked %v", id, seen)
+		}
+	}
+}
+
+func TestSnapshotType(t *testing.T) {
+	setGlobal(t, &snapshotType, "manual")
+	b, _ := newFakeBackend()
+	ctx := context.Background()
+
+	// the newest manual snapshot of each is still being taken
+	c, _, err := b.getClusterSnapshot(ctx, "demo-cluster")
+	if err != nil || aws.ToString(c.DBClusterSnapshotIdentifier) != "rds:demo-cluster-5" {
+		t.Errorf("got %s, %v, want rds:demo-cluster-5", aws.ToString(c.DBClusterSnapshotIdentifier), err)
+	}
+	s, _, err := b.getInstanceSnapshot(ctx, "demo-db")
+	if err != nil || aws.ToString(s.DBSnapshotIdentifier) != "rds:demo-db-5" {
+		t.Errorf("got %s, %v, want rds:demo-db-5", aws.ToString(s.DBSnapshotIdentifier), err)
+	}
+
+	setGlobal(t, &snapshotType, "awsbackup")
+	_, _, err = b.getInstanceSnapshot(ctx, "demo-db")
+	if err == nil || !strings.Contains(err.Error(), "no snapshots found") {
+		t.Errorf("got %v, want no awsbackup snapshots", err)
+	}
+}
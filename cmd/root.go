@@ -3,41 +3,51 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"os/signal"
-	"reflect"
-	"strconv"
+	"sync"
 	"syscall"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
-	clusterID   string
-	instanceID  string
-	postDir     string
-	preDir      string
-	proxy       string
-	proxyKey    string
-	proxySubnet string
-	proxyVPC    string
-
-	instanceType = "db.t3.medium"
-	list         = false
-	proxyCreate  = false
+	awsProfile    string
+	awsRegion     string
+	endpointURL   string
+	maxAttempts   int
+	retryMode     string
+	roleARN       string
+	sourceProfile string
+	sourceRoleARN string
+
+	postDir       string
+	preDir        string
+	proxy         string
+	proxyKey      string
+	proxyHostKeys []string
+	knownHosts    string
+	proxySubnet   string
+	proxyVPC      string
+	stateFile     string
+
+	instanceType    = "db.t3.medium"
+	proxyCreate     = false
+	insecureHostKey = false
+	ttl             = 24 * time.Hour
+
+	proxyAMI          string
+	proxyIngress      []string
+	proxyAMIParameter string
+	proxyInstanceType = "t4g.nano"
+	proxyPort         = 22
+	proxyUser         = "ubuntu"
 
 	logger *log.Logger
 )
 
-type bagOfHolding []interface{}
-
 type envVar struct {
 	Key   string
 	Value interface{}
@@ -46,7 +56,8 @@ type envVar struct {
 var rootCmd = &cobra.Command{
 	Use:   "rdsvalidator",
 	Short: "CLI to automate validation of RDS backups",
-	Run:   main,
+
+	PersistentPreRunE: applyConfig,
 }
 
 // Execute adds all child commands to the root command and sets flags
@@ -55,222 +66,87 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 }
 
+// fatal logs v like logger.Fatal, but exits with code.
+func fatal(code int, v ...interface{}) {
+	logger.Output(2, fmt.Sprint(v...))
+	os.Exit(code)
+}
+
 func init() {
 	logger = log.New(os.Stderr, "", log.Lshortfile)
 
 	cobra.OnInitialize(initConfig)
-	rootCmd.PersistentFlags().StringVar(&clusterID, "cluster-id", clusterID, "use latest snapshot for specified cluster ID")
-	rootCmd.PersistentFlags().StringVar(&instanceID, "instance-id", instanceID, "use latest snapshot for specified instance ID")
-	rootCmd.PersistentFlags().StringVar(&instanceType, "instance-type", instanceType, "RDS instance type")
-	rootCmd.PersistentFlags().BoolVar(&list, "list", list, "list available DB clusters and instances")
-	rootCmd.PersistentFlags().StringVar(&postDir, "post", postDir, "directory containing scripts to execute after DB creation")
-	rootCmd.PersistentFlags().StringVar(&preDir, "pre", preDir, "directory containing scripts to execute before DB creation")
-	rootCmd.PersistentFlags().StringVar(&proxy, "proxy", proxy, "host used to proxy DB connections")
-	rootCmd.PersistentFlags().BoolVar(&proxyCreate, "proxy-create", proxyCreate, "create ephemeral SSH proxy for DB connections")
-	rootCmd.PersistentFlags().StringVar(&proxyKey, "proxy-key", proxyKey, "proxy private key")
-	rootCmd.PersistentFlags().StringVar(&proxySubnet, "proxy-subnet", proxySubnet, "subnet used to deploy ephemeral SSH proxy")
-	rootCmd.PersistentFlags().StringVar(&proxyVPC, "proxy-vpc", proxyVPC, "VPC used to deploy ephemeral SSH proxy")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", cfgFile, "config file (default $HOME/.rdsvalidator.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", profileName, "named profile from the config file")
+	rootCmd.PersistentFlags().StringVar(&awsRegion, "region", awsRegion, "AWS region to work in (default from the AWS config)")
+	rootCmd.PersistentFlags().StringVar(&awsProfile, "aws-profile", awsProfile, "AWS shared config profile to use")
+	rootCmd.PersistentFlags().StringVar(&roleARN, "role-arn", roleARN, "IAM role to assume")
+	rootCmd.PersistentFlags().StringVar(&sourceProfile, "source-aws-profile", sourceProfile, "AWS shared config profile for the account holding the backups")
+	rootCmd.PersistentFlags().StringVar(&sourceRoleARN, "source-role-arn", sourceRoleARN, "IAM role to assume in the account holding the backups")
+	rootCmd.PersistentFlags().StringVar(&retryMode, "retry-mode", retryMode, "AWS retry mode, standard or adaptive (default from the AWS config)")
+	rootCmd.PersistentFlags().IntVar(&maxAttempts, "max-attempts", maxAttempts, "maximum attempts per AWS API call (default from the AWS config)")
+	rootCmd.PersistentFlags().StringVar(&endpointURL, "endpoint-url", endpointURL, "send every AWS API call to this endpoint, e.g. for a local emulator")
 }
 
-func initConfig() {
-	viper.SetEnvPrefix("RV")
-	viper.AutomaticEnv() // read in environment variables that match RV_*
+// ledgers of runs in flight, listed if we are forced to exit before they
+// are torn down
+var active = struct {
+	sync.Mutex
+	runs map[*ledger]bool
+}{runs: make(map[*ledger]bool)}
+
+func track(l *ledger) {
+	active.Lock()
+	defer active.Unlock()
+	active.runs[l] = true
 }
 
-func catchSignal(b *bagOfHolding) {
-	sig := make(chan os.Signal, 1)
-	// signal.Notify(sig)
-	signal.Notify(sig, os.Interrupt, syscall.SIGINT, syscall.SIGQUIT)
-	_ = <-sig
-	cleanup(b)
+func untrack(l *ledger) {
+	active.Lock()
+	defer active.Unlock()
+	delete(active.runs, l)
 }
 
-func cleanup(b *bagOfHolding) {
-	fmt.Println("Starting cleanup...")
-	// walk through created resources in reverse
-	for i := len(*b) - 1; i >= 0; i-- {
-		v := (*b)[i]
-		switch v.(type) {
-		case *exec.Cmd:
-			defer v.(exec.Cmd).Process.Release()
-		case *ec2.CreateKeyPairOutput:
-			k := aws.ToString(v.(ec2.CreateKeyPairOutput).KeyPairId)
-			deleteKeypair(context.TODO(), k)
-		case types.Instance:
-			i := aws.ToString(v.(types.Instance).InstanceId)
-			deleteProxy(context.TODO(), i)
-		case createDBResult:
-			d := aws.ToString(v.(createDBResult).Instance.DBInstanceIdentifier)
-			deleteDatabaseInstance(context.TODO(), d)
-		case *ec2.CreateSecurityGroupOutput:
-			g := aws.ToString(v.(ec2.CreateSecurityGroupOutput).GroupId)
-			deleteSecurityGroup(context.TODO(), g)
-		default:
-			fmt.Println(reflect.TypeOf(v).String())
-		}
-	}
+// signalContext returns a context cancelled by the first SIGINT, SIGTERM or
+// SIGHUP, so runs stop and tear down what they created. A second signal
+// exits at once, leaving state files for the cleanup command.
+func signalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
 
-	os.Exit(255)
-}
-
-func main(cmd *cobra.Command, args []string) {
-	ctx := context.Background()
-
-	var state bagOfHolding // copy of created resources
-	go catchSignal(&state) // cleanup on signal
-	defer cleanup(&state)  // cleanup on normal return
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
-	if list {
-		res, err := getDatabases(ctx)
-		if err != nil {
-			logger.Fatal(err)
+	go func() {
+		select {
+		case s := <-sig:
+			fmt.Fprintf(os.Stderr, "Received %s, stopping and cleaning up (interrupt again to exit immediately)...\n", s)
+			cancel()
+		case <-ctx.Done():
+			return
 		}
-		err = printDatabases(res)
-		if err != nil {
-			logger.Fatal(err)
-		}
-		return
-	}
 
-	if (len(clusterID) == 0 && len(instanceID) == 0) || (len(clusterID) > 0 && len(instanceID) > 0) {
-		logger.Fatal("USAGE: Must specify one of --cluster-id or --instance-id")
-	}
+		<-sig
+		forceExit()
+	}()
 
-	if len(preDir) > 0 {
-		err := runScripts(preDir, nil)
-		if err != nil {
-			logger.Fatal(err)
-		}
-	}
-
-	// create security group now so we have id when creating database
-	var groupID string
-	if proxyCreate {
-		if len(proxyVPC) == 0 || len(proxySubnet) == 0 {
-			logger.Fatal("USAGE: Must provide --proxy-vpc and --proxy-subnet")
-		}
-
-		sg, err := createSecurityGroup(ctx, proxyVPC)
-		if err != nil {
-			logger.Fatal(err)
-		}
-
-		groupID = aws.ToString(sg.GroupId)
-		state = append(state, sg)
-	}
-
-	var res createDBResult
-	if len(clusterID) > 0 {
-		snapshot, err := getClusterSnapshot(ctx, clusterID)
-		if err != nil {
-			logger.Println(err)
-			return // make sure defer runs
-		}
-		fmt.Printf("Using latest cluster snapshot: '%s' (%s)\n", aws.ToString(snapshot.DBClusterSnapshotIdentifier), snapshot.SnapshotCreateTime.String())
-
-		res, err = createClusterFromSnapshot(ctx, snapshot, groupID)
-		if err != nil {
-			logger.Println(err)
-			return // make sure defer runs
-		}
+	return ctx, func() {
+		signal.Stop(sig)
+		cancel()
 	}
+}
 
-	if len(instanceID) > 0 {
-		snapshot, err := getInstanceSnapshot(ctx, instanceID)
-		if err != nil {
-			logger.Println(err)
-			return // make sure defer runs
-		}
-		fmt.Printf("Using latest instance snapshot: '%s' (%s)\n", aws.ToString(snapshot.DBSnapshotIdentifier), snapshot.SnapshotCreateTime.String())
-
-		res, err = createInstanceFromSnapshot(ctx, snapshot, groupID)
-		if err != nil {
-			logger.Println(err)
-			return // make sure defer runs
-		}
-	}
-
-	state = append(state, res)
-
-	// TODO: allow customizing ports
-	dbHost := aws.ToString(res.Instance.Endpoint.Address)
-	dbPort := int(res.Instance.Endpoint.Port)
-	localPort := dbPort + 10000
-
-	if proxyCreate || len(proxy) > 0 {
-		dbHost = "localhost"
-	}
-
-	vars := []envVar{
-		{
-			Key:   "DB_HOST",
-			Value: dbHost,
-		},
-		{
-			Key:   "DB_NAME",
-			Value: res.Instance.DBName,
-		},
-		{
-			Key:   "DB_PORT",
-			Value: strconv.Itoa(localPort),
-		},
-		{
-			Key:   "DB_USER",
-			Value: aws.ToString(res.Instance.MasterUsername),
-		},
-	}
-
-	var c *exec.Cmd
-	if len(proxy) > 0 {
-		if len(proxyKey) == 0 {
-			logger.Println("USAGE: Must provide --proxy-key")
-			return // make sure defer runs
-		}
-
-		key, err := ioutil.ReadFile(proxyKey)
-		if err != nil {
-			logger.Println(err)
-			return // make sure defer runs
-		}
-
-		c, err = setupSSHTunnel(proxy, aws.ToString(res.Instance.Endpoint.Address), string(key), localPort, dbPort)
-		if err != nil {
-			logger.Println(err)
-			return // make sure defer runs
-		}
-	} else if proxyCreate {
-		proxy, err := createProxy(ctx, groupID)
-		if err != nil {
-			logger.Println(err)
-			return // make sure defer runs
-		}
-
-		proxyAddr := aws.ToString(proxy.Instance.PublicIpAddress)
-		key := aws.ToString(proxy.Keypair.KeyMaterial)
-		c, err = setupSSHTunnel(proxyAddr, aws.ToString(res.Instance.Endpoint.Address), key, localPort, dbPort)
-		if err != nil {
-			logger.Println(err)
-			return // make sure defer runs
-		}
-		state = append(state, proxy.Instance, proxy.Keypair)
-	}
-	state = append(state, c)
+// forceExit abandons runs in flight, pointing at their state files.
+func forceExit() {
+	active.Lock()
+	defer active.Unlock()
 
-	if len(postDir) > 0 {
-		err := runScripts(postDir, vars)
-		if err != nil {
-			logger.Fatal(err)
-		}
+	fmt.Fprintln(os.Stderr, "WARNING: exiting without cleanup, resources may be left behind")
+	for l := range active.runs {
+		fmt.Fprintf(os.Stderr, "  rdsvalidator cleanup --state %s\n", l.path)
 	}
-
-	// debug
-	fmt.Println("Waiting...")
-	fmt.Scanln()
-
-	cmd.Help()
-	return // make sure defer runs
+	os.Exit(exitInterrupted)
 }
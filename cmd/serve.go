@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	scheduleFile string
+	historyFile  = "rdsvalidator-history.jsonl"
+)
+
+// schedule is one entry in the schedule file.
+type schedule struct {
+	Name       string `mapstructure:"name"`
+	Cron       string `mapstructure:"cron"`
+	ClusterID  string `mapstructure:"cluster-id"`
+	InstanceID string `mapstructure:"instance-id"`
+	Pre        string `mapstructure:"pre"`
+	Post       string `mapstructure:"post"`
+}
+
+// runRecord is the persisted outcome of one scheduled run.
+type runRecord struct {
+	Schedule string    `json:"schedule"`
+	Kind     string    `json:"kind"`
+	ID       string    `json:"id"`
+	RunID    string    `json:"run_id,omitempty"`
+	Snapshot string    `json:"snapshot,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Status   string    `json:"status"` // passed, failed, error, stale or interrupted
+	// seconds spent in each phase of the run
+	Phases map[string]float64 `json:"phases,omitempty"`
+	Error  string             `json:"error,omitempty"`
+	// resources teardown could not remove, alerted on apart from Status
+	Leftover []string `json:"leftover,omitempty"`
+}
+
+// scheduler runs validations from a schedule, never more than one per source.
+type scheduler struct {
+	b *backend
+
+	mu      sync.Mutex
+	running map[string]runRecord // keyed by source
+	history *os.File
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run validations on cron-style schedules until stopped",
+	Run:   runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&scheduleFile, "schedule", scheduleFile, "YAML file listing schedules to run")
+	serveCmd.Flags().StringVar(&historyFile, "history", historyFile, "file run outcomes are appended to as JSON lines")
+	addRunFlags(serveCmd.Flags())
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) {
+	if len(scheduleFile) == 0 {
+		fatal(exitUsage, "USAGE: Must provide --schedule")
+	}
+	err := checkRunFlags()
+	if err != nil {
+		fatal(exitUsage, err)
+	}
+
+	schedules, err := loadSchedules(scheduleFile)
+	if err != nil {
+		fatal(exitUsage, err)
+	}
+
+	ctx, stop := signalContext(context.Background())
+	defer stop()
+
+	b, err := newBackend(ctx)
+	if err != nil {
+		fatal(exitError, err)
+	}
+
+	history, err := os.OpenFile(historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fatal(exitError, err)
+	}
+	defer history.Close()
+
+	s := &scheduler{
+		b:       b,
+		running: make(map[string]runRecord),
+		history: history,
+	}
+
+	c := cron.New()
+	for _, v := range schedules {
+		sc := v
+		_, err := c.AddFunc(sc.Cron, func() { s.run(ctx, sc) })
+		if err != nil {
+			fatal(exitUsage, fmt.Sprintf("schedule %s: %v", sc.Name, err))
+		}
+		fmt.Printf("Scheduled %s (%s)\n", sc.Name, sc.Cron)
+	}
+	c.Start()
+
+	<-ctx.Done()
+
+	// runs in flight see the cancellation and tear down; wait for them
+	fmt.Println("Shutting down, cleaning up in-flight runs...")
+	<-c.Stop().Done()
+}
+
+func loadSchedules(path string) ([]schedule, error) {
+	var schedules []schedule
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	err := v.ReadInConfig()
+	if err != nil {
+		return schedules, err
+	}
+
+	err = v.UnmarshalKey("schedules", &schedules)
+	if err != nil {
+		return schedules, err
+	}
+
+	if len(schedules) == 0 {
+		return schedules, fmt.Errorf("no schedules found in %s", path)
+	}
+	for i, sc := range schedules {
+		if len(sc.Cron) == 0 {
+			return schedules, fmt.Errorf("schedule %d: missing cron expression", i+1)
+		}
+		if (len(sc.ClusterID) == 0) == (len(sc.InstanceID) == 0) {
+			return schedules, fmt.Errorf("schedule %d: must specify one of cluster-id or instance-id", i+1)
+		}
+		if len(sc.Name) == 0 {
+			schedules[i].Name = sc.ClusterID + sc.InstanceID
+		}
+	}
+
+	return schedules, nil
+}
+
+func (sc schedule) target() target {
+	t := target{Kind: "instance", ID: sc.InstanceID, PreDir: preDir, PostDir: postDir}
+	if len(sc.ClusterID) > 0 {
+		t.Kind = "cluster"
+		t.ID = sc.ClusterID
+	}
+	if len(sc.Pre) > 0 {
+		t.PreDir = sc.Pre
+	}
+	if len(sc.Post) > 0 {
+		t.PostDir = sc.Post
+	}
+	return t
+}
+
+func (s *scheduler) run(ctx context.Context, sc schedule) {
+	t := sc.target()
+	key := t.Kind + "/" + t.ID
+
+	s.mu.Lock()
+	if _, busy := s.running[key]; busy {
+		s.mu.Unlock()
+		fmt.Printf("Skipping %s: previous run of %s still in progress\n", sc.Name, key)
+		return
+	}
+	rec := runRecord{
+		Schedule: sc.Name,
+		Kind:     t.Kind,
+		ID:       t.ID,
+		Started:  time.Now().UTC(),
+	}
+	s.running[key] = rec
+	s.mu.Unlock()
+
+	if runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, runTimeout)
+		defer cancel()
+	}
+
+	res := validateTarget(ctx, s.b.withPrefix("["+sc.Name+"] "), t)
+
+	rec.RunID = res.RunID
+	rec.Snapshot = res.Snapshot
+	rec.Finished = time.Now().UTC()
+	for _, err := range res.Leftover {
+		rec.Leftover = append(rec.Leftover, err.Error())
+	}
+	for _, p := range res.Phases {
+		if rec.Phases == nil {
+			rec.Phases = make(map[string]float64)
+		}
+		rec.Phases[p.Name] = p.Duration.Seconds()
+	}
+	rec.Status = strings.ToLower(res.status())
+	if res.Err != nil {
+		rec.Error = res.Err.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, key)
+	err := s.record(rec)
+	if err != nil {
+		logger.Println(err)
+	}
+}
+
+// record appends rec to the history file; callers must hold s.mu.
+func (s *scheduler) record(rec runRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.history.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return s.history.Sync()
+}
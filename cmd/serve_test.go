@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadSchedules(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{
+			name: "valid",
+			yaml: "schedules:\n- cron: \"@daily\"\n  cluster-id: demo-cluster\n- name: db\n  cron: \"0 3 * * *\"\n  instance-id: demo-db\n",
+		},
+		{
+			name: "both IDs",
+			yaml: "schedules:\n- cron: \"@daily\"\n  cluster-id: demo-cluster\n  instance-id: demo-db\n",
+			err:  "schedule 1: must specify one of cluster-id or instance-id",
+		},
+		{
+			name: "neither ID",
+			yaml: "schedules:\n- cron: \"@daily\"\n  cluster-id: demo-cluster\n- cron: \"@daily\"\n",
+			err:  "schedule 2: must specify one of cluster-id or instance-id",
+		},
+		{
+			name: "no cron",
+			yaml: "schedules:\n- instance-id: demo-db\n",
+			err:  "schedule 1: missing cron expression",
+		},
+		{
+			name: "no schedules",
+			yaml: "schedules: []\n",
+			err:  "no schedules found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "schedules.yaml")
+			err := os.WriteFile(path, []byte(tt.yaml), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadSchedules(path)
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 || got[0].Name != "demo-cluster" || got[1].Name != "db" || got[1].target().Kind != "instance" {
+				t.Errorf("got %+v, want demo-cluster and db", got)
+			}
+		})
+	}
+}
+
+func TestSchedulerSkipsSourceInFlight(t *testing.T) {
+	setGlobal(t, &stateFile, filepath.Join(t.TempDir(), "state.json"))
+	history, err := os.Create(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+
+	// hold the first run in its first wait until the second has been tried
+	b, _ := newFakeBackend()
+	waiting := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	b.sleep = func(ctx context.Context, _ time.Duration) error {
+		once.Do(func() {
+			close(waiting)
+			<-release
+		})
+		return ctx.Err()
+	}
+	s := &scheduler{
+		b:       b,
+		running: make(map[string]runRecord),
+		history: history,
+	}
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	go func() {
+		s.run(ctx, schedule{Name: "first", Cron: "@daily", InstanceID: "demo-db"})
+		close(done)
+	}()
+	<-waiting
+
+	s.run(ctx, schedule{Name: "second", Cron: "@hourly", InstanceID: "demo-db"})
+	records := readHistory(t, history.Name())
+	if len(records) != 0 {
+		t.Errorf("skipped run recorded %+v", records)
+	}
+
+	close(release)
+	<-done
+	records = readHistory(t, history.Name())
+	if len(records) != 1 || records[0].Schedule != "first" || records[0].Status != "passed" {
+		t.Errorf("recorded %+v, want only the first run, passed", records)
+	}
+}
+
+func readHistory(t *testing.T, path string) []runRecord {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []runRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		var rec runRecord
+		err := json.Unmarshal([]byte(line), &rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
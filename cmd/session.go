@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// sessionOptions identify the account and region a session works in.
+type sessionOptions struct {
+	region  string // default from the AWS config
+	profile string
+	roleARN string
+}
+
+// newSession resolves AWS configuration once: credentials (assuming
+// opts.roleARN if set), region, and the retry and endpoint settings shared
+// by every session.
+func newSession(ctx context.Context, opts sessionOptions) (aws.Config, error) {
+	var load []func(*config.LoadOptions) error
+	if len(opts.region) > 0 {
+		load = append(load, config.WithRegion(opts.region))
+	}
+	if len(opts.profile) > 0 {
+		load = append(load, config.WithSharedConfigProfile(opts.profile))
+	}
+	if len(retryMode) > 0 {
+		mode, err := aws.ParseRetryMode(retryMode)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		load = append(load, config.WithRetryMode(mode))
+	}
+	if maxAttempts > 0 {
+		load = append(load, config.WithRetryMaxAttempts(maxAttempts))
+	}
+	if len(endpointURL) > 0 {
+		load = append(load, config.WithEndpointResolverWithOptions(aws.EndpointResolverWithOptionsFunc(
+			func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+				return aws.Endpoint{URL: endpointURL, SigningRegion: region}, nil
+			})))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, load...)
+	if err != nil {
+		return cfg, err
+	}
+
+	if len(opts.roleARN) > 0 {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), opts.roleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "rdsvalidator"
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	clusterID  string
+	instanceID string
+)
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "List snapshots available for a DB cluster or instance",
+	Run:   runSnapshots,
+}
+
+func init() {
+	snapshotsCmd.Flags().StringVar(&clusterID, "cluster-id", clusterID, "list snapshots for specified cluster ID")
+	snapshotsCmd.Flags().StringVar(&instanceID, "instance-id", instanceID, "list snapshots for specified instance ID")
+	snapshotsCmd.Flags().StringVar(&snapshotType, "snapshot-type", snapshotType, "only list snapshots of this type (automated, manual, shared or awsbackup)")
+	rootCmd.AddCommand(snapshotsCmd)
+}
+
+func runSnapshots(cmd *cobra.Command, args []string) {
+	if (len(clusterID) == 0 && len(instanceID) == 0) || (len(clusterID) > 0 && len(instanceID) > 0) {
+		fatal(exitUsage, "USAGE: Must specify one of --cluster-id or --instance-id")
+	}
+
+	ctx := context.Background()
+
+	b, err := newBackend(ctx)
+	if err != nil {
+		fatal(exitError, err)
+	}
+
+	if len(clusterID) > 0 {
+		snapshots, err := b.lookup().listClusterSnapshots(ctx, clusterID)
+		if err != nil {
+			fatal(exitError, err)
+		}
+		err = printSnapshots(snapshots, nil)
+		if err != nil {
+			fatal(exitError, err)
+		}
+		return
+	}
+
+	snapshots, err := b.lookup().listInstanceSnapshots(ctx, instanceID)
+	if err != nil {
+		fatal(exitError, err)
+	}
+	err = printSnapshots(nil, snapshots)
+	if err != nil {
+		fatal(exitError, err)
+	}
+}
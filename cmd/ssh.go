@@ -1,66 +1,230 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
-func setupSSHTunnel(proxy, targetHost, privateKey string, localPort, remotePort int) (*exec.Cmd, error) {
-	// debug
-	fmt.Println(proxy)
-	fmt.Println(privateKey)
+// how long to wait for sshd on a new proxy to accept us
+const sshWaitLimit = 10 * time.Minute
+
+// tunnel forwards connections to a local port through an SSH proxy to a
+// host reachable from it, until closed.
+type tunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	remote   string
+	errOut   io.Writer
 
-	c := &exec.Cmd{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
 
-	tmpFile, err := ioutil.TempFile(os.TempDir(), "rdsvalidator-")
+// loadProxyKey reads the private key given with --proxy-key.
+func loadProxyKey(path string) (ssh.Signer, error) {
+	key, err := os.ReadFile(path)
 	if err != nil {
-		return c, err
+		return nil, err
 	}
-	defer func() {
-		tmpFile.Close()
-		os.Remove(tmpFile.Name())
-	}()
 
-	_, err = tmpFile.Write([]byte(privateKey))
+	signer, err := ssh.ParsePrivateKey(key)
 	if err != nil {
-		return c, err
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
 	}
+	return signer, nil
+}
 
-	// TODO: make port configurable
-	fmt.Printf("Waiting on proxy %s:22...", proxy)
-	c = exec.Command("ssh", "-i", tmpFile.Name(), fmt.Sprintf("ubuntu@%s", proxy), "uname")
-	c.Stdout = nil
-	c.Stderr = nil
-	for {
-		err = c.Run()
-		// debug - some times hangs in this loop
-		fmt.Println(err)
+// openTunnel connects to proxy as signer, retrying until sshd is up, and
+// forwards localhost:localPort, or a free port when localPort is 0, to
+// targetHost:remotePort. When hostKeys are given, the proxy must present a
+// key with one of those SHA256 fingerprints, otherwise one known_hosts
+// lists for it, unless --insecure-ignore-host-key is set.
+func (b *backend) openTunnel(ctx context.Context, proxy string, signer ssh.Signer, hostKeys []string, targetHost string, localPort, remotePort int) (*tunnel, error) {
+	addr := net.JoinHostPort(proxy, strconv.Itoa(proxyPort))
+	config := &ssh.ClientConfig{
+		User:    proxyUser,
+		Auth:    []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		Timeout: 10 * time.Second,
+	}
+
+	// a mismatch fails at once rather than being retried like sshd not
+	// being up yet
+	var mismatch error
+	switch {
+	case len(hostKeys) > 0:
+		config.HostKeyCallback = func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			fp := ssh.FingerprintSHA256(key)
+			if contains(hostKeys, fp) {
+				return nil
+			}
+			mismatch = fmt.Errorf("host key %s of proxy %s is not one of %s, refusing to forward", fp, addr, strings.Join(hostKeys, ", "))
+			return mismatch
+		}
+	case insecureHostKey:
+		fmt.Fprintf(b.errOut, "WARNING: not verifying the host key of proxy %s\n", addr)
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		path, err := knownHostsPath()
+		if err != nil {
+			return nil, err
+		}
+		known, err := knownhosts.New(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w; pass --proxy-host-key, or --insecure-ignore-host-key to skip the check", err)
+		}
+		config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			err := known(hostname, remote, key)
+			if err != nil {
+				mismatch = fmt.Errorf("host key %s of proxy %s is not in %s: %v, refusing to forward", ssh.FingerprintSHA256(key), addr, path, err)
+			}
+			return mismatch
+		}
+	}
+
+	fmt.Fprintf(b.out, "Waiting on proxy %s...", addr)
+	var client *ssh.Client
+	var dialErr error
+	err := b.poll(ctx, "proxy "+addr, time.Second, sshWaitLimit, func(ctx context.Context) (bool, error) {
+		client, dialErr = dialSSH(ctx, addr, config)
+		return dialErr == nil, mismatch
+	})
+	if mismatch != nil {
+		return nil, mismatch
+	}
+	if err != nil && dialErr != nil {
+		return nil, fmt.Errorf("%w: %v", err, dialErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(b.out, "done.")
+
+	t := &tunnel{
+		client: client,
+		remote: net.JoinHostPort(targetHost, strconv.Itoa(remotePort)),
+		errOut: b.errOut,
+	}
+
+	fmt.Fprintf(b.out, "Setting up tunnel to %s...", t.remote)
+
+	// fail now, rather than on the first connection, if the proxy can't
+	// reach the database
+	conn, err := client.Dial("tcp", t.remote)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("proxy cannot reach %s: %w", t.remote, err)
+	}
+	conn.Close()
+
+	t.listener, err = net.Listen("tcp", net.JoinHostPort("localhost", strconv.Itoa(localPort)))
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
 
+	t.wg.Add(1)
+	go t.serve()
+	fmt.Fprintln(b.out, "done.")
+
+	return t, nil
+}
+
+// Port is the local port the tunnel listens on.
+func (t *tunnel) Port() int {
+	return t.listener.Addr().(*net.TCPAddr).Port
+}
+
+// knownHostsPath is --known-hosts, or ~/.ssh/known_hosts by default.
+func knownHostsPath() (string, error) {
+	if len(knownHosts) > 0 {
+		return knownHosts, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// dialSSH connects to addr, giving up on the handshake after
+// config.Timeout.
+func dialSSH(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	d := net.Dialer{Timeout: config.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// the handshake has no timeout of its own
+	conn.SetDeadline(time.Now().Add(config.Timeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func (t *tunnel) serve() {
+	defer t.wg.Done()
+
+	for {
+		local, err := t.listener.Accept()
 		if err != nil {
-			time.Sleep(1 * time.Second)
-			fmt.Print(".")
-			continue
+			return // closed
 		}
-		fmt.Println("done.")
-		break
-	}
-
-	fmt.Print("Setting up tunnel...")
-	proxyString := strconv.Itoa(localPort) + fmt.Sprintf(":%s:", targetHost) + strconv.Itoa(remotePort)
-	// debug
-	fmt.Println(proxyString)
-	// TODO: make username configurable
-	c = exec.Command("ssh", "-i", tmpFile.Name(), "-L", proxyString,
-		"-fN", "-o 'ExitOnForwardFailure yes'", fmt.Sprintf("ubuntu@%s", proxy))
-	err = c.Start()
+
+		t.wg.Add(1)
+		go t.forward(local)
+	}
+}
+
+// forward copies between local and a new connection through the proxy
+// until either side is done.
+func (t *tunnel) forward(local net.Conn) {
+	defer t.wg.Done()
+	defer local.Close()
+
+	remote, err := t.client.Dial("tcp", t.remote)
 	if err != nil {
-		return c, err
+		fmt.Fprintf(t.errOut, "tunnel to %s: %v\n", t.remote, err)
+		return
 	}
-	fmt.Println("done.")
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
 
-	return c, nil
+// Close stops listening, drops every forwarded connection and disconnects
+// from the proxy, returning once all of them are gone.
+func (t *tunnel) Close() error {
+	var err error
+	t.once.Do(func() {
+		err = t.listener.Close()
+		t.client.Close()
+		t.wg.Wait()
+	})
+	return err
 }
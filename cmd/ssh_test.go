@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// listen accepts connections on a free local port until the test ends,
+// handing each to handle.
+func listen(t *testing.T, handle func(net.Conn)) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// startProxy runs an sshd stand-in that accepts any client key and
+// forwards direct-tcpip channels, to the address route returns for the
+// requested one when given, returning its port and host key.
+func startProxy(t *testing.T, route func(addr string) string) (int, ssh.PublicKey) {
+	t.Helper()
+	hostKey := newTestSigner(t)
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	port := listen(t, func(conn net.Conn) {
+		defer conn.Close()
+		_, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+
+		for nc := range chans {
+			var target struct {
+				Host     string
+				Port     uint32
+				OrigHost string
+				OrigPort uint32
+			}
+			if nc.ChannelType() != "direct-tcpip" || ssh.Unmarshal(nc.ExtraData(), &target) != nil {
+				nc.Reject(ssh.UnknownChannelType, "only direct-tcpip")
+				continue
+			}
+			addr := net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port)))
+			if route != nil {
+				addr = route(addr)
+			}
+			remote, err := net.Dial("tcp", addr)
+			if err != nil {
+				nc.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			ch, chReqs, err := nc.Accept()
+			if err != nil {
+				remote.Close()
+				continue
+			}
+			go ssh.DiscardRequests(chReqs)
+			go func() {
+				defer ch.Close()
+				defer remote.Close()
+				go io.Copy(remote, ch)
+				io.Copy(ch, remote)
+			}()
+		}
+	})
+
+	return port, hostKey.PublicKey()
+}
+
+func startEcho(t *testing.T) int {
+	t.Helper()
+	return listen(t, func(conn net.Conn) {
+		defer conn.Close()
+		io.Copy(conn, conn)
+	})
+}
+
+func TestTunnelPinnedHostKey(t *testing.T) {
+	port, hostKey := startProxy(t, nil)
+	setGlobal(t, &proxyPort, port)
+	b, _ := newFakeBackend()
+
+	tun, err := b.openTunnel(context.Background(), "127.0.0.1", newTestSigner(t), []string{"SHA256:other", ssh.FingerprintSHA256(hostKey)}, "127.0.0.1", 0, startEcho(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tun.Close()
+	checkEcho(t, tun)
+}
+
+// checkEcho checks that what is written to tun comes back.
+func checkEcho(t *testing.T, tun *tunnel) {
+	t.Helper()
+	conn, err := net.Dial("tcp", net.JoinHostPort("localhost", strconv.Itoa(tun.Port())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	_, err = conn.Write([]byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 4)
+	_, err = io.ReadFull(conn, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ping" {
+		t.Errorf("read %q through the tunnel, want %q", got, "ping")
+	}
+}
+
+func TestTunnelHostKeyMismatch(t *testing.T) {
+	port, _ := startProxy(t, nil)
+	setGlobal(t, &proxyPort, port)
+	b, _ := newFakeBackend()
+
+	attempts := 0
+	b.sleep = func(ctx context.Context, _ time.Duration) error {
+		attempts++
+		return ctx.Err()
+	}
+
+	_, err := b.openTunnel(context.Background(), "127.0.0.1", newTestSigner(t), []string{"SHA256:other"}, "127.0.0.1", 0, startEcho(t))
+	if err == nil || !strings.Contains(err.Error(), "refusing to forward") {
+		t.Fatalf("got %v, want a host key mismatch", err)
+	}
+	// not retried until sshWaitLimit like a proxy that isn't up yet
+	if attempts != 1 {
+		t.Errorf("connected %d times, want once", attempts)
+	}
+}
+
+func TestTunnelKnownHosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    func(addr string, key ssh.PublicKey) string
+		insecure bool
+		wantErr  string
+	}{
+		{
+			name: "listed",
+			lines: func(addr string, key ssh.PublicKey) string {
+				return knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)
+			},
+		},
+		{
+			name: "other key",
+			lines: func(addr string, _ ssh.PublicKey) string {
+				return knownhosts.Line([]string{knownhosts.Normalize(addr)}, newTestSigner(t).PublicKey())
+			},
+			wantErr: "refusing to forward",
+		},
+		{
+			name: "other host",
+			lines: func(_ string, key ssh.PublicKey) string {
+				return knownhosts.Line([]string{"proxy.example.com"}, key)
+			},
+			wantErr: "refusing to forward",
+		},
+		{
+			name:    "no file",
+			wantErr: "--insecure-ignore-host-key",
+		},
+		{
+			name:     "no file, insecure",
+			insecure: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, hostKey := startProxy(t, nil)
+			setGlobal(t, &proxyPort, port)
+			setGlobal(t, &insecureHostKey, tt.insecure)
+			path := filepath.Join(t.TempDir(), "known_hosts")
+			setGlobal(t, &knownHosts, path)
+			if tt.lines != nil {
+				addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+				err := os.WriteFile(path, []byte(tt.lines(addr, hostKey)+"\n"), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			b, _ := newFakeBackend()
+			attempts := 0
+			b.sleep = func(ctx context.Context, _ time.Duration) error {
+				attempts++
+				return ctx.Err()
+			}
+
+			tun, err := b.openTunnel(context.Background(), "127.0.0.1", newTestSigner(t), nil, "127.0.0.1", 0, startEcho(t))
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				if attempts > 1 {
+					t.Errorf("connected %d times, want at most once", attempts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tun.Close()
+			checkEcho(t, tun)
+		})
+	}
+}
+
+func TestHostKeyFingerprints(t *testing.T) {
+	// as cloud-init prints them, with EC2's prefix and line endings
+	console := strings.Join([]string{
+		"[   24.187154] cloud-init[1180]: Cloud-init v. 22.2-0ubuntu1~20.04.3 running 'modules:final'",
+		"ci-info: no authorized SSH keys fingerprints found for user ubuntu.",
+		"ec2: ",
+		"ec2: #############################################################",
+		"ec2: -----BEGIN SSH HOST KEY FINGERPRINTS-----",
+		"ec2: 1024 SHA256:r4YqVDjU6kdUMv8CQk1qw3d5oJ3bsG0x1OzAbJ6Yd3s root@ip-10-0-1-23 (DSA)",
+		"ec2: 256 SHA256:4nV1yq0h6vUq3KkR1H3hV0bI2sQyWj5iYw9dG5Qe7Ok root@ip-10-0-1-23 (ECDSA)",
+		"ec2: 256 SHA256:Wq3b5F0o3S8pXQ0l6s0Jd2wz6kL4yYc2mE1rN9tH8vU root@ip-10-0-1-23 (ED25519)",
+		"ec2: 3072 SHA256:Jx2mY7cT1pQ9wV5nB3kL8fR6dH4sA0zE2uI7oP1gK5M root@ip-10-0-1-23 (RSA)",
+		"ec2: -----END SSH HOST KEY FINGERPRINTS-----",
+		"ec2: #############################################################",
+		"-----BEGIN SSH HOST KEY KEYS-----",
+		"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHtj5QnQ4oE2bUcT1yA7XzW9rLk3sVd0pJm6fGh8iN2q root@ip-10-0-1-23",
+		"-----END SSH HOST KEY KEYS-----",
+		"[   24.301128] cloud-init[1180]: Cloud-init v. 22.2-0ubuntu1~20.04.3 finished",
+	}, "\r\n")
+
+	got := hostKeyFingerprints(console)
+	want := []string{
+		"SHA256:r4YqVDjU6kdUMv8CQk1qw3d5oJ3bsG0x1OzAbJ6Yd3s",
+		"SHA256:4nV1yq0h6vUq3KkR1H3hV0bI2sQyWj5iYw9dG5Qe7Ok",
+		"SHA256:Wq3b5F0o3S8pXQ0l6s0Jd2wz6kL4yYc2mE1rN9tH8vU",
+		"SHA256:Jx2mY7cT1pQ9wV5nB3kL8fR6dH4sA0zE2uI7oP1gK5M",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// resource kinds recorded in the ledger
+const (
+	kindSecurityGroup = "security-group"
+	kindKeypair       = "keypair"
+	kindProxy         = "ec2-instance"
+	kindDBCluster     = "db-cluster"
+	kindDBInstance    = "db-instance"
+
+	kindDBClusterSnapshot = "db-cluster-snapshot"
+	kindDBSnapshot        = "db-snapshot"
+)
+
+// location is the region and account a run worked in, and the credentials
+// it used, so cleanup can look for its resources in the same place.
+type location struct {
+	Region  string `json:"region"`
+	Account string `json:"account"`
+	Profile string `json:"profile,omitempty"`
+	RoleARN string `json:"role_arn,omitempty"`
+}
+
+type resource struct {
+	Kind    string    `json:"kind"`
+	ID      string    `json:"id"`
+	RunID   string    `json:"run_id,omitempty"`
+	Created time.Time `json:"created"`
+	Source  bool      `json:"source,omitempty"` // lives in the source account
+}
+
+// ledger is an on-disk record of everything a run creates, written as soon
+// as each resource exists so a crashed run can be torn down later.
+type ledger struct {
+	mu        sync.Mutex
+	path      string
+	RunID     string     `json:"run_id"`
+	Target    *location  `json:"target"`
+	Source    *location  `json:"source,omitempty"` // when backups are elsewhere
+	Resources []resource `json:"resources"`
+}
+
+// newLedger starts a ledger for a run working with b.
+func newLedger(path, runID string, b *backend) (*ledger, error) {
+	l := &ledger{path: path, RunID: runID, Target: b.location()}
+	if b.src != nil {
+		l.Source = b.src.location()
+	}
+	return l, l.save()
+}
+
+func loadLedger(path string) (*ledger, error) {
+	l := &ledger{path: path}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return l, err
+	}
+	err = json.Unmarshal(b, l)
+	if err != nil {
+		return l, err
+	}
+
+	return l, nil
+}
+
+func (l *ledger) add(kind, id string) error {
+	return l.append(resource{Kind: kind, ID: id})
+}
+
+// addSource records a resource created with the source account's
+// credentials.
+func (l *ledger) addSource(kind, id string) error {
+	return l.append(resource{Kind: kind, ID: id, Source: true})
+}
+
+func (l *ledger) append(r resource) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r.RunID = l.RunID
+	r.Created = time.Now().UTC()
+	l.Resources = append(l.Resources, r)
+
+	return l.save()
+}
+
+func (l *ledger) remove(r resource) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, v := range l.Resources {
+		if v.Kind == r.Kind && v.ID == r.ID && v.Source == r.Source {
+			l.Resources = append(l.Resources[:i], l.Resources[i+1:]...)
+			break
+		}
+	}
+
+	return l.save()
+}
+
+// reversed returns a copy of the recorded resources, newest first.
+func (l *ledger) reversed() []resource {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := make([]resource, 0, len(l.Resources))
+	for i := len(l.Resources) - 1; i >= 0; i-- {
+		r = append(r, l.Resources[i])
+	}
+	return r
+}
+
+// save writes the ledger atomically; callers must hold l.mu (or own l).
+func (l *ledger) save() error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), l.path)
+}
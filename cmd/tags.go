@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// tags applied to everything we create so leftovers can be found by gc
+const (
+	tagRunID   = "rdsvalidator:run-id"
+	tagCreated = "rdsvalidator:created"
+	tagTTL     = "rdsvalidator:ttl"
+)
+
+func runTags(runID string) map[string]string {
+	return map[string]string{
+		tagRunID:   runID,
+		tagCreated: time.Now().UTC().Format(time.RFC3339),
+		tagTTL:     ttl.String(),
+	}
+}
+
+func ec2Tags(runID string, resourceTypes ...ec2types.ResourceType) []ec2types.TagSpecification {
+	var tags []ec2types.Tag
+	for k, v := range runTags(runID) {
+		tags = append(tags, ec2types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	var specs []ec2types.TagSpecification
+	for _, t := range resourceTypes {
+		specs = append(specs, ec2types.TagSpecification{ResourceType: t, Tags: tags})
+	}
+	return specs
+}
+
+func rdsTags(runID string) []rdstypes.Tag {
+	var tags []rdstypes.Tag
+	for k, v := range runTags(runID) {
+		tags = append(tags, rdstypes.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return tags
+}
+
+func ec2TagMap(tags []ec2types.Tag) map[string]string {
+	m := make(map[string]string)
+	for _, t := range tags {
+		m[aws.ToString(t.Key)] = aws.ToString(t.Value)
+	}
+	return m
+}
+
+func rdsTagMap(tags []rdstypes.Tag) map[string]string {
+	m := make(map[string]string)
+	for _, t := range tags {
+		m[aws.ToString(t.Key)] = aws.ToString(t.Value)
+	}
+	return m
+}
+
+// taggedResource builds a resource from our tags, reporting false if the
+// tags are missing or the resource has not yet outlived its TTL.
+func taggedResource(kind, id string, tags map[string]string, now time.Time) (resource, bool) {
+	r := resource{Kind: kind, ID: id}
+
+	if _, ok := tags[tagRunID]; !ok {
+		return r, false
+	}
+
+	created, err := time.Parse(time.RFC3339, tags[tagCreated])
+	if err != nil {
+		return r, false
+	}
+	d, err := time.ParseDuration(tags[tagTTL])
+	if err != nil {
+		return r, false
+	}
+
+	r.Created = created
+	r.RunID = tags[tagRunID]
+	return r, now.After(created.Add(d))
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	tunnelHost      string
+	tunnelPort      = 5432
+	tunnelLocalPort = 0
+)
+
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel",
+	Short: "Forward a local port to a DB endpoint through an SSH proxy until interrupted",
+	Run:   runTunnel,
+}
+
+func init() {
+	tunnelCmd.Flags().StringVar(&proxy, "proxy", proxy, "host used to proxy DB connections")
+	tunnelCmd.Flags().StringVar(&proxyKey, "proxy-key", proxyKey, "proxy private key")
+	tunnelCmd.Flags().StringVar(&proxyUser, "proxy-user", proxyUser, "SSH user on the proxy")
+	tunnelCmd.Flags().IntVar(&proxyPort, "proxy-port", proxyPort, "SSH port on the proxy")
+	tunnelCmd.Flags().StringSliceVar(&proxyHostKeys, "proxy-host-key", proxyHostKeys, "SHA256 fingerprint the proxy host key must match, may be repeated")
+	tunnelCmd.Flags().StringVar(&knownHosts, "known-hosts", knownHosts, "known_hosts file checked when no --proxy-host-key is given (default ~/.ssh/known_hosts)")
+	tunnelCmd.Flags().BoolVar(&insecureHostKey, "insecure-ignore-host-key", insecureHostKey, "connect without verifying the proxy host key")
+	tunnelCmd.Flags().StringVar(&tunnelHost, "db-host", tunnelHost, "DB endpoint address reachable from the proxy")
+	tunnelCmd.Flags().IntVar(&tunnelPort, "db-port", tunnelPort, "DB endpoint port")
+	tunnelCmd.Flags().IntVar(&tunnelLocalPort, "local-port", tunnelLocalPort, "local port to listen on (default db-port + 10000)")
+	rootCmd.AddCommand(tunnelCmd)
+}
+
+func runTunnel(cmd *cobra.Command, args []string) {
+	if len(proxy) == 0 || len(proxyKey) == 0 || len(tunnelHost) == 0 {
+		fatal(exitUsage, "USAGE: Must provide --proxy, --proxy-key and --db-host")
+	}
+	if tunnelLocalPort == 0 {
+		tunnelLocalPort = tunnelPort + 10000
+	}
+
+	key, err := loadProxyKey(proxyKey)
+	if err != nil {
+		fatal(exitError, err)
+	}
+
+	ctx, stop := signalContext(context.Background())
+	defer stop()
+
+	// no AWS calls are made, only waiting and progress
+	b := &backend{sleep: sleepContext, out: os.Stdout, errOut: os.Stderr}
+
+	t, err := b.openTunnel(ctx, proxy, key, proxyHostKeys, tunnelHost, tunnelLocalPort, tunnelPort)
+	if err != nil {
+		fatal(exitError, err)
+	}
+
+	fmt.Printf("Forwarding localhost:%d to %s:%d, interrupt to stop\n", t.Port(), tunnelHost, tunnelPort)
+	<-ctx.Done()
+
+	err = t.Close()
+	if err != nil {
+		fatal(exitError, err)
+	}
+}
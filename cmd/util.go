@@ -1,12 +1,23 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
-func randomString(length int) string {
+func init() {
 	rand.Seed(time.Now().UnixNano())
+}
+
+func randomString(length int) string {
 	var letterRunes = []rune("abcdefghijkmnopqrstuvwxyzABCDEFGHIJKLMNPQRSTUVWXYZ123456789")
 
 	b := make([]rune, length)
@@ -15,3 +26,94 @@ func randomString(length int) string {
 	}
 	return string(b)
 }
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// prefixWriter buffers partial lines and writes each complete line to w
+// with prefix prepended.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		_, err := fmt.Fprintf(p.w, "%s%s", p.prefix, p.buf[:i+1])
+		if err != nil {
+			return len(b), err
+		}
+		p.buf = p.buf[i+1:]
+	}
+
+	return len(b), nil
+}
+
+// checkEgressIP asks an AWS endpoint which address our requests come from.
+func checkEgressIP(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://checkip.amazonaws.com", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("checkip.amazonaws.com returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", err
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return "", fmt.Errorf("checkip.amazonaws.com returned %q, not an address", body)
+	}
+	return ip.String(), nil
+}
+
+// optionalString returns nil for an empty string so unset filters are
+// omitted from API calls.
+func optionalString(s string) *string {
+	if len(s) == 0 {
+		return nil
+	}
+	return &s
+}
+
+// optionalSlice returns nil for an empty string, so AWS applies its default
+// instead of rejecting an empty ID.
+func optionalSlice(s string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return []string{s}
+}
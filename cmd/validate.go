@@ -0,0 +1,774 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	clusterIDs         []string
+	copyFromRegion     string
+	instanceIDs        []string
+	kmsKeyID           string
+	runTimeout         time.Duration
+	sourceKMSKeyID     string
+	latestRestorable   bool
+	maxRestoreDuration time.Duration
+	maxSnapshotAge     time.Duration
+	restoreTime        string
+	snapshotID         string
+	snapshotType       string
+	snapshotWindow     time.Duration
+	targetsFile        string
+
+	concurrency      = 4
+	snapshotStrategy = strategyLatest
+)
+
+// exit codes
+const (
+	exitPassed  = 0
+	exitFailed  = 1 // a script or check failed
+	exitError   = 2 // AWS access or the restore itself failed
+	exitCleanup = 3 // resources were left behind
+	exitStale   = 4 // a backup was older than --max-snapshot-age
+
+	exitUsage       = 64  // bad flags, config or input files
+	exitInterrupted = 130 // stopped by a signal
+)
+
+var (
+	errCheckFailed = errors.New("check failed")
+	errStaleBackup = errors.New("stale backup")
+)
+
+// target is a source database to validate.
+type target struct {
+	Kind    string // "cluster" or "instance"
+	ID      string
+	PreDir  string
+	PostDir string
+}
+
+type runResult struct {
+	Target    target
+	RunID     string
+	StateFile string
+	Snapshot  string
+	Phases    []phase
+	Err       error
+	Leftover  []error // resources teardown could not remove
+}
+
+// phase is how long one step of a run took.
+type phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+func timed(name string, start time.Time) phase {
+	return phase{Name: name, Duration: time.Since(start)}
+}
+
+// timePhase records the named phase as having started at start.
+func (r *runResult) timePhase(name string, start time.Time) {
+	r.Phases = append(r.Phases, timed(name, start))
+}
+
+func total(phases []phase) time.Duration {
+	var d time.Duration
+	for _, p := range phases {
+		d += p.Duration
+	}
+	return d
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Restore a snapshot or point in time, run validation scripts against it and tear it down",
+	Run:   runValidate,
+}
+
+func init() {
+	validateCmd.Flags().StringSliceVar(&clusterIDs, "cluster-id", clusterIDs, "use latest snapshot for specified cluster IDs")
+	validateCmd.Flags().StringSliceVar(&instanceIDs, "instance-id", instanceIDs, "use latest snapshot for specified instance IDs")
+	validateCmd.Flags().StringVar(&targetsFile, "targets", targetsFile, "file listing databases to validate, one \"cluster <id>\" or \"instance <id>\" per line")
+	validateCmd.Flags().StringVar(&snapshotID, "snapshot-id", snapshotID, "restore this snapshot instead of selecting one (single database only)")
+	validateCmd.Flags().IntVar(&concurrency, "concurrency", concurrency, "maximum number of databases validated at once")
+	validateCmd.Flags().StringVar(&stateFile, "state", stateFile, "file recording created resources when validating a single database (default rdsvalidator-<run-id>.json)")
+	addRunFlags(validateCmd.Flags())
+	rootCmd.AddCommand(validateCmd)
+}
+
+// addRunFlags registers the flags shared by everything that performs
+// validation runs.
+func addRunFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&instanceType, "instance-type", instanceType, "RDS instance type")
+	fs.StringVar(&postDir, "post", postDir, "directory containing scripts to execute after DB creation")
+	fs.StringVar(&preDir, "pre", preDir, "directory containing scripts to execute before DB creation")
+	fs.StringVar(&snapshotType, "snapshot-type", snapshotType, "only consider snapshots of this type (automated, manual, shared or awsbackup)")
+	fs.StringVar(&snapshotStrategy, "snapshot-strategy", snapshotStrategy, "how to pick a snapshot: latest, or random within the retention window")
+	fs.DurationVar(&snapshotWindow, "snapshot-window", snapshotWindow, "window used by the random strategy (default the source's backup retention period, or no limit if the source is gone)")
+	fs.StringVar(&copyFromRegion, "copy-from-region", copyFromRegion, "select the snapshot in this region and copy it to --region before restoring")
+	fs.StringVar(&kmsKeyID, "kms-key-id", kmsKeyID, "KMS key used to encrypt snapshot copies in the target region and account")
+	fs.StringVar(&sourceKMSKeyID, "source-kms-key-id", sourceKMSKeyID, "KMS key, shared with the target account, used to encrypt snapshot copies shared from the source account")
+	fs.DurationVar(&maxRestoreDuration, "max-restore-duration", maxRestoreDuration, "fail if creating the database takes longer than this, not counting snapshot lookup and copies")
+	fs.DurationVar(&maxSnapshotAge, "max-snapshot-age", maxSnapshotAge, "fail without restoring if the newest backup is older than this (e.g. 26h)")
+	fs.StringVar(&restoreTime, "restore-time", restoreTime, "restore to this point in time (RFC 3339) instead of a snapshot")
+	fs.BoolVar(&latestRestorable, "latest-restorable", latestRestorable, "restore to the latest restorable point in time instead of a snapshot")
+	fs.StringVar(&proxy, "proxy", proxy, "host used to proxy DB connections")
+	fs.BoolVar(&proxyCreate, "proxy-create", proxyCreate, "create ephemeral SSH proxy for DB connections")
+	fs.StringVar(&proxyKey, "proxy-key", proxyKey, "proxy private key")
+	fs.StringSliceVar(&proxyHostKeys, "proxy-host-key", proxyHostKeys, "SHA256 fingerprint the --proxy host key must match, may be repeated")
+	fs.StringVar(&knownHosts, "known-hosts", knownHosts, "known_hosts file checked for --proxy when no --proxy-host-key is given (default ~/.ssh/known_hosts)")
+	fs.BoolVar(&insecureHostKey, "insecure-ignore-host-key", insecureHostKey, "connect to --proxy without verifying its host key")
+	fs.StringVar(&proxySubnet, "proxy-subnet", proxySubnet, "subnet used to deploy ephemeral SSH proxy")
+	fs.StringVar(&proxyVPC, "proxy-vpc", proxyVPC, "VPC used to deploy ephemeral SSH proxy")
+	fs.StringVar(&proxyAMI, "proxy-ami", proxyAMI, "AMI for the ephemeral SSH proxy (default latest Ubuntu 20.04)")
+	fs.StringVar(&proxyAMIParameter, "proxy-ami-parameter", proxyAMIParameter, "SSM parameter holding the AMI for the ephemeral SSH proxy, e.g. /aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-arm64")
+	fs.StringVar(&proxyInstanceType, "proxy-instance-type", proxyInstanceType, "EC2 instance type for the ephemeral SSH proxy")
+	fs.StringSliceVar(&proxyIngress, "proxy-ingress-cidr", proxyIngress, "CIDR allowed to SSH to the ephemeral proxy, may be repeated (default this machine's egress IP)")
+	fs.StringVar(&proxyUser, "proxy-user", proxyUser, "SSH user on the proxy")
+	fs.IntVar(&proxyPort, "proxy-port", proxyPort, "SSH port on the proxy")
+	fs.DurationVar(&ttl, "ttl", ttl, "time after which created resources are eligible for gc")
+	fs.DurationVar(&runTimeout, "timeout", runTimeout, "abandon and tear down runs still going after this long")
+}
+
+func checkRunFlags() error {
+	switch snapshotType {
+	case "", "automated", "manual", "shared", "awsbackup":
+	default:
+		return fmt.Errorf("USAGE: unknown --snapshot-type %q", snapshotType)
+	}
+	if snapshotStrategy != strategyLatest && snapshotStrategy != strategyRandom {
+		return fmt.Errorf("USAGE: --snapshot-strategy must be %s or %s", strategyLatest, strategyRandom)
+	}
+	if len(restoreTime) > 0 {
+		if latestRestorable {
+			return errors.New("USAGE: --restore-time and --latest-restorable are mutually exclusive")
+		}
+		_, err := time.Parse(time.RFC3339, restoreTime)
+		if err != nil {
+			return fmt.Errorf("USAGE: --restore-time must be RFC 3339, e.g. 2006-01-02T15:04:05Z: %v", err)
+		}
+	}
+	if pointInTime() && len(snapshotID) > 0 {
+		return errors.New("USAGE: --snapshot-id can't be combined with a point in time restore")
+	}
+	crossAccount := len(sourceProfile) > 0 || len(sourceRoleARN) > 0
+	if pointInTime() && (len(copyFromRegion) > 0 || crossAccount) {
+		return errors.New("USAGE: point in time restores can't cross regions or accounts")
+	}
+	if len(kmsKeyID) > 0 && len(copyFromRegion) == 0 && !crossAccount {
+		return errors.New("USAGE: --kms-key-id requires --copy-from-region or source account credentials")
+	}
+	if len(sourceKMSKeyID) > 0 && !crossAccount {
+		return errors.New("USAGE: --source-kms-key-id requires --source-role-arn or --source-aws-profile")
+	}
+	if proxyCreate && (len(proxyVPC) == 0 || len(proxySubnet) == 0) {
+		return errors.New("USAGE: Must provide --proxy-vpc and --proxy-subnet")
+	}
+	if proxyCreate && len(proxy) > 0 {
+		return errors.New("USAGE: --proxy and --proxy-create are mutually exclusive")
+	}
+	if len(proxy) > 0 && len(proxyKey) == 0 {
+		return errors.New("USAGE: Must provide --proxy-key")
+	}
+	if len(proxyAMI) > 0 && len(proxyAMIParameter) > 0 {
+		return errors.New("USAGE: --proxy-ami and --proxy-ami-parameter are mutually exclusive")
+	}
+	for _, c := range proxyIngress {
+		_, _, err := net.ParseCIDR(c)
+		if err != nil {
+			return fmt.Errorf("USAGE: --proxy-ingress-cidr %q is not a CIDR", c)
+		}
+	}
+	if proxyPort < 1 || proxyPort > 65535 {
+		return fmt.Errorf("USAGE: --proxy-port %d is not a valid port", proxyPort)
+	}
+	return nil
+}
+
+func runValidate(cmd *cobra.Command, args []string) {
+	targets, err := collectTargets()
+	if err != nil {
+		fatal(exitUsage, err)
+	}
+
+	if len(targets) == 0 {
+		fatal(exitUsage, "USAGE: Must specify --cluster-id, --instance-id or --targets")
+	}
+	if len(targets) > 1 && len(snapshotID) > 0 {
+		fatal(exitUsage, "USAGE: --snapshot-id can only be used when validating a single database")
+	}
+	if len(targets) > 1 && len(stateFile) > 0 {
+		fatal(exitUsage, "USAGE: --state can only be used when validating a single database")
+	}
+	if concurrency < 1 {
+		fatal(exitUsage, "USAGE: --concurrency must be at least 1")
+	}
+	err = checkRunFlags()
+	if err != nil {
+		fatal(exitUsage, err)
+	}
+
+	ctx, stop := signalContext(context.Background())
+	defer stop()
+
+	b, err := newBackend(ctx)
+	if err != nil {
+		fatal(exitError, err)
+	}
+
+	if runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, runTimeout)
+		defer cancel()
+	}
+
+	results := validateAll(ctx, b, targets)
+	printSummary(results)
+	os.Exit(exitCode(results))
+}
+
+// collectTargets merges IDs given as flags with those listed in --targets.
+func collectTargets() ([]target, error) {
+	var targets []target
+
+	for _, v := range clusterIDs {
+		targets = append(targets, target{Kind: "cluster", ID: v, PreDir: preDir, PostDir: postDir})
+	}
+	for _, v := range instanceIDs {
+		targets = append(targets, target{Kind: "instance", ID: v, PreDir: preDir, PostDir: postDir})
+	}
+
+	if len(targetsFile) == 0 {
+		return targets, nil
+	}
+
+	f, err := os.Open(targetsFile)
+	if err != nil {
+		return targets, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 || (fields[0] != "cluster" && fields[0] != "instance") {
+			return targets, fmt.Errorf("%s:%d: expected \"cluster <id>\" or \"instance <id>\"", targetsFile, n)
+		}
+		targets = append(targets, target{Kind: fields[0], ID: fields[1], PreDir: preDir, PostDir: postDir})
+	}
+
+	return targets, scanner.Err()
+}
+
+// validateAll runs each target with at most concurrency in flight, returning
+// results in target order.
+func validateAll(ctx context.Context, b *backend, targets []target) []runResult {
+	results := make([]runResult, len(targets))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if ctx.Err() != nil {
+				results[i] = runResult{Target: t, Err: fmt.Errorf("not started: %w", ctx.Err())}
+				return
+			}
+
+			rb := b
+			if len(targets) > 1 {
+				rb = b.withPrefix("[" + t.ID + "] ")
+			}
+			results[i] = validateTarget(ctx, rb, t)
+		}(i, t)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// validateTarget runs one validation with its own run ID, ledger and
+// security group, always tearing down what it created.
+func validateTarget(ctx context.Context, b *backend, t target) runResult {
+	res := runResult{Target: t, RunID: randomString(8)}
+
+	res.StateFile = stateFile
+	if len(res.StateFile) == 0 {
+		res.StateFile = "rdsvalidator-" + res.RunID + ".json"
+	}
+
+	state, err := newLedger(res.StateFile, res.RunID, b) // record of created resources
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	fmt.Fprintf(b.out, "Starting run %s, recording created resources in %s\n", res.RunID, res.StateFile)
+
+	track(state)
+	defer untrack(state)
+
+	res.Err = b.validate(ctx, t, state, &res)
+	if res.Err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		res.Err = fmt.Errorf("timed out after %s: %w (%v)", runTimeout, ctx.Err(), res.Err)
+	} else if res.Err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		// whatever failed did so because we stopped it, e.g. a script
+		// killed by its context
+		res.Err = fmt.Errorf("interrupted: %w (%v)", ctx.Err(), res.Err)
+	}
+	if res.Err != nil {
+		fmt.Fprintln(b.errOut, res.Err)
+	}
+
+	// a fresh context, so cleanup still runs when ours has expired
+	fmt.Fprintln(b.out, "Starting cleanup...")
+	res.Leftover = teardown(context.Background(), b, state)
+
+	return res
+}
+
+func (b *backend) validate(ctx context.Context, t target, state *ledger, res *runResult) error {
+	if len(t.PreDir) > 0 {
+		phases, err := runScripts(ctx, b.out, b.errOut, t.PreDir, nil)
+		res.Phases = append(res.Phases, phases...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// create security groups now so we have ids when creating the database;
+	// the proxy's admits SSH from outside, the database's only the proxy
+	var proxyGroupID, dbGroupID string
+	if proxyCreate {
+		cidrs, err := b.ingressCIDRs(ctx)
+		if err != nil {
+			return err
+		}
+
+		sg, err := b.createSecurityGroup(ctx, proxyVPC, "proxy", state)
+		if err != nil {
+			return err
+		}
+		proxyGroupID = aws.ToString(sg.GroupId)
+
+		err = b.allowCIDRs(ctx, proxyGroupID, proxyPort, cidrs)
+		if err != nil {
+			return err
+		}
+
+		sg, err = b.createSecurityGroup(ctx, proxyVPC, "database", state)
+		if err != nil {
+			return err
+		}
+		dbGroupID = aws.ToString(sg.GroupId)
+	}
+
+	db, err := b.restore(ctx, t, dbGroupID, state, res)
+	res.Phases = append(res.Phases, db.Phases...)
+	if err != nil {
+		return err
+	}
+
+	dbHost := aws.ToString(db.Instance.Endpoint.Address)
+	dbPort := int(db.Instance.Endpoint.Port)
+	clientPort := dbPort
+
+	if len(proxy) > 0 || proxyCreate {
+		proxyAddr := proxy
+		hostKeys := proxyHostKeys
+		var key ssh.Signer
+		var err error
+		if len(proxy) > 0 {
+			key, err = loadProxyKey(proxyKey)
+			if err != nil {
+				return err
+			}
+		} else {
+			// the engine port is only known once the database is up
+			err = b.allowGroup(ctx, dbGroupID, proxyGroupID, dbPort)
+			if err != nil {
+				return err
+			}
+
+			start := time.Now()
+			p, err := b.createProxy(ctx, proxyGroupID, state)
+			if err != nil {
+				return err
+			}
+			res.timePhase("proxy ready", start)
+
+			proxyAddr = aws.ToString(p.Instance.PublicIpAddress)
+			key = p.Keypair.Signer
+			hostKeys = p.HostKeys
+		}
+
+		start := time.Now()
+		// concurrent runs each need their own local end of the tunnel, so
+		// let the kernel pick one
+		tun, err := b.openTunnel(ctx, proxyAddr, key, hostKeys, dbHost, 0, dbPort)
+		if err != nil {
+			return err
+		}
+		defer tun.Close()
+		res.timePhase("tunnel up", start)
+
+		dbHost = "localhost"
+		clientPort = tun.Port()
+	}
+
+	vars := []envVar{
+		{
+			Key:   "DB_HOST",
+			Value: dbHost,
+		},
+		{
+			Key:   "DB_NAME",
+			Value: aws.ToString(db.Instance.DBName),
+		},
+		{
+			Key:   "DB_PORT",
+			Value: strconv.Itoa(clientPort),
+		},
+		{
+			Key:   "DB_USER",
+			Value: aws.ToString(db.Instance.MasterUsername),
+		},
+	}
+
+	if len(t.PostDir) > 0 {
+		phases, err := runScripts(ctx, b.out, b.errOut, t.PostDir, vars)
+		res.Phases = append(res.Phases, phases...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ingressCIDRs returns --proxy-ingress-cidr, or the address our traffic
+// leaves from when none were given.
+func (b *backend) ingressCIDRs(ctx context.Context) ([]string, error) {
+	if len(proxyIngress) > 0 {
+		return proxyIngress, nil
+	}
+
+	fmt.Fprint(b.out, "Detecting egress IP...")
+	ip, err := b.egressIP(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("detecting egress IP, set --proxy-ingress-cidr instead: %w", err)
+	}
+	cidr := ip + "/32"
+	if strings.Contains(ip, ":") {
+		cidr = ip + "/128"
+	}
+	fmt.Fprintln(b.out, cidr)
+
+	return []string{cidr}, nil
+}
+
+// restore creates the database under test from a snapshot or point in time.
+func (b *backend) restore(ctx context.Context, t target, groupID string, state *ledger, res *runResult) (createDBResult, error) {
+	if pointInTime() {
+		return b.restorePointInTime(ctx, t, groupID, state, res)
+	}
+
+	src := b.lookup()
+
+	start := time.Now()
+	if t.Kind == "cluster" {
+		snapshot, newest, err := src.getClusterSnapshot(ctx, t.ID)
+		if err != nil {
+			return createDBResult{}, err
+		}
+		res.timePhase("snapshot lookup", start)
+		res.Snapshot = aws.ToString(snapshot.DBClusterSnapshotIdentifier)
+		fmt.Fprintf(b.out, "Using %s cluster snapshot: '%s' (%s)\n", selectionName(), res.Snapshot, snapshot.SnapshotCreateTime.String())
+		err = checkFreshness("newest snapshot of "+t.ID, newest)
+		if err != nil {
+			return createDBResult{}, err
+		}
+
+		start = time.Now()
+		copied := false
+		if b.crossAccount() {
+			snapshot, err = src.shareClusterSnapshot(ctx, snapshot, b.account, state)
+			if err != nil {
+				return createDBResult{}, err
+			}
+			copied = true
+		}
+		// shared encrypted snapshots are copied with a key this account can use
+		if len(copyFromRegion) > 0 || (b.crossAccount() && snapshot.StorageEncrypted) {
+			snapshot, err = b.copyClusterSnapshot(ctx, snapshot, copyFromRegion, kmsKeyID, state)
+			if err != nil {
+				return createDBResult{}, err
+			}
+			copied = true
+		}
+		if copied {
+			res.timePhase("snapshot copy", start)
+		}
+
+		return createWithin(ctx, func(ctx context.Context) (createDBResult, error) {
+			return b.createClusterFromSnapshot(ctx, snapshot, groupID, state)
+		})
+	}
+
+	snapshot, newest, err := src.getInstanceSnapshot(ctx, t.ID)
+	if err != nil {
+		return createDBResult{}, err
+	}
+	res.timePhase("snapshot lookup", start)
+	res.Snapshot = aws.ToString(snapshot.DBSnapshotIdentifier)
+	fmt.Fprintf(b.out, "Using %s instance snapshot: '%s' (%s)\n", selectionName(), res.Snapshot, snapshotTaken(snapshot).String())
+	err = checkFreshness("newest snapshot of "+t.ID, newest)
+	if err != nil {
+		return createDBResult{}, err
+	}
+
+	start = time.Now()
+	copied := false
+	if b.crossAccount() {
+		snapshot, err = src.shareInstanceSnapshot(ctx, snapshot, b.account, state)
+		if err != nil {
+			return createDBResult{}, err
+		}
+		copied = true
+	}
+	// shared encrypted snapshots are copied with a key this account can use
+	if len(copyFromRegion) > 0 || (b.crossAccount() && snapshot.Encrypted) {
+		snapshot, err = b.copyInstanceSnapshot(ctx, snapshot, copyFromRegion, kmsKeyID, state)
+		if err != nil {
+			return createDBResult{}, err
+		}
+		copied = true
+	}
+	if copied {
+		res.timePhase("snapshot copy", start)
+	}
+
+	return createWithin(ctx, func(ctx context.Context) (createDBResult, error) {
+		return b.createInstanceFromSnapshot(ctx, snapshot, groupID, state)
+	})
+}
+
+// createWithin runs create, abandoning it past --max-restore-duration.
+// Only creating the database counts, as its phases are the restore time
+// reported; snapshot lookup and copies don't.
+func createWithin(ctx context.Context, create func(context.Context) (createDBResult, error)) (createDBResult, error) {
+	if maxRestoreDuration == 0 {
+		return create(ctx)
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, maxRestoreDuration)
+	defer cancel()
+
+	db, err := create(rctx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return db, fmt.Errorf("%w: restore did not finish within %s", errCheckFailed, maxRestoreDuration)
+	}
+	if err != nil {
+		return db, err
+	}
+	if d := total(db.Phases); d > maxRestoreDuration {
+		return db, fmt.Errorf("%w: restore took %s, more than %s", errCheckFailed, d.Round(time.Millisecond), maxRestoreDuration)
+	}
+
+	return db, nil
+}
+
+// restorePointInTime restores t as of --restore-time or its latest
+// restorable time.
+func (b *backend) restorePointInTime(ctx context.Context, t target, groupID string, state *ledger, res *runResult) (createDBResult, error) {
+	start := time.Now()
+	if t.Kind == "cluster" {
+		output, err := b.rds.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
+			DBClusterIdentifier: aws.String(t.ID),
+		})
+		if err != nil {
+			return createDBResult{}, err
+		}
+		if len(output.DBClusters) == 0 {
+			return createDBResult{}, fmt.Errorf("source cluster %s not found", t.ID)
+		}
+		source := output.DBClusters[0]
+		res.timePhase("snapshot lookup", start)
+
+		err = checkFreshness("latest restorable time of "+t.ID, aws.ToTime(source.LatestRestorableTime))
+		if err != nil {
+			return createDBResult{}, err
+		}
+
+		at, err := restorePoint(source.EarliestRestorableTime, source.LatestRestorableTime)
+		if err != nil {
+			return createDBResult{}, err
+		}
+		res.Snapshot = t.ID + " at " + at.Format(time.RFC3339)
+		fmt.Fprintf(b.out, "Using %s cluster point in time: '%s' (%s)\n", selectionName(), t.ID, at.String())
+
+		return createWithin(ctx, func(ctx context.Context) (createDBResult, error) {
+			return b.createClusterToPointInTime(ctx, source, at, groupID, state)
+		})
+	}
+
+	output, err := b.rds.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: aws.String(t.ID),
+	})
+	if err != nil {
+		return createDBResult{}, err
+	}
+	if len(output.DBInstances) == 0 {
+		return createDBResult{}, fmt.Errorf("source instance %s not found", t.ID)
+	}
+	source := output.DBInstances[0]
+	res.timePhase("snapshot lookup", start)
+
+	err = checkFreshness("latest restorable time of "+t.ID, aws.ToTime(source.LatestRestorableTime))
+	if err != nil {
+		return createDBResult{}, err
+	}
+
+	at, err := restorePoint(nil, source.LatestRestorableTime)
+	if err != nil {
+		return createDBResult{}, err
+	}
+	res.Snapshot = t.ID + " at " + at.Format(time.RFC3339)
+	fmt.Fprintf(b.out, "Using %s instance point in time: '%s' (%s)\n", selectionName(), t.ID, at.String())
+
+	return createWithin(ctx, func(ctx context.Context) (createDBResult, error) {
+		return b.createInstanceToPointInTime(ctx, source, at, groupID, state)
+	})
+}
+
+// checkFreshness fails with errStaleBackup if a backup taken at created is
+// older than --max-snapshot-age.
+func checkFreshness(what string, created time.Time) error {
+	if maxSnapshotAge == 0 || created.IsZero() {
+		return nil
+	}
+
+	age := time.Since(created)
+	if age > maxSnapshotAge {
+		return fmt.Errorf("%w: %s is %s old, more than %s", errStaleBackup, what, age.Round(time.Minute), maxSnapshotAge)
+	}
+
+	return nil
+}
+
+// pointInTime reports whether runs restore to a point in time rather than
+// from a snapshot.
+func pointInTime() bool {
+	return latestRestorable || len(restoreTime) > 0
+}
+
+// selectionName describes how the snapshot being restored was chosen.
+func selectionName() string {
+	if len(snapshotID) > 0 || len(restoreTime) > 0 {
+		return "requested"
+	}
+	if latestRestorable {
+		return "latest restorable"
+	}
+	return snapshotStrategy
+}
+
+// printSummary reports every run and how many did not pass.
+func printSummary(results []runResult) {
+	failed := 0
+
+	fmt.Println("Summary:")
+	for _, r := range results {
+		status := r.status()
+		if r.Err != nil {
+			status += ": " + r.Err.Error()
+			failed++
+		}
+		fmt.Printf("  %-8s %-30s run %s  %s\n", r.Target.Kind, r.Target.ID, r.RunID, status)
+		if len(r.Snapshot) > 0 {
+			fmt.Printf("           backup %s\n", r.Snapshot)
+		}
+		for _, p := range r.Phases {
+			fmt.Printf("           %-30s %s\n", p.Name, p.Duration.Round(time.Millisecond))
+		}
+		if len(r.Leftover) > 0 {
+			fmt.Printf("           %d resources left behind, see %s\n", len(r.Leftover), r.StateFile)
+		}
+	}
+	fmt.Printf("%d passed, %d failed\n", len(results)-failed, failed)
+}
+
+// status names the outcome of a run, apart from cleanup.
+func (r runResult) status() string {
+	switch {
+	case r.Err == nil:
+		return "PASSED"
+	case errors.Is(r.Err, errStaleBackup):
+		return "STALE"
+	case errors.Is(r.Err, context.Canceled):
+		return "INTERRUPTED"
+	case errors.Is(r.Err, errCheckFailed):
+		return "FAILED"
+	}
+	return "ERROR"
+}
+
+// exitCode picks the exit status for a set of runs. Leftover resources come
+// first since they cost money until someone acts, then interrupted runs,
+// then stale backups since restoring them proves little, then failed
+// checks, then other errors.
+func exitCode(results []runResult) int {
+	seen := make(map[int]bool)
+	for _, r := range results {
+		seen[r.exitCode()] = true
+	}
+
+	for _, c := range []int{exitCleanup, exitInterrupted, exitStale, exitFailed, exitError} {
+		if seen[c] {
+			return c
+		}
+	}
+	return exitPassed
+}
+
+func (r runResult) exitCode() int {
+	switch {
+	case len(r.Leftover) > 0:
+		return exitCleanup
+	case r.Err == nil:
+		return exitPassed
+	case errors.Is(r.Err, errStaleBackup):
+		return exitStale
+	case errors.Is(r.Err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(r.Err, errCheckFailed):
+		return exitFailed
+	}
+	return exitError
+}
@@ -0,0 +1,742 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"golang.org/x/crypto/ssh"
+)
+
+// setGlobal sets a flag variable for the rest of a test.
+func setGlobal[T any](t *testing.T, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// runTarget validates tg with its state file in a temporary directory.
+func runTarget(t *testing.T, b *backend, tg target) runResult {
+	t.Helper()
+	return runTargetContext(t, context.Background(), b, tg)
+}
+
+func runTargetContext(t *testing.T, ctx context.Context, b *backend, tg target) runResult {
+	t.Helper()
+	setGlobal(t, &stateFile, filepath.Join(t.TempDir(), "state.json"))
+	return validateTarget(ctx, b, tg)
+}
+
+// writeScript creates an executable shell script in a new directory,
+// returning the directory.
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "01-check.sh"), []byte("#!/bin/sh\n"+body+"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func checkDeletions(t *testing.T, f *fakeAWS, want ...string) {
+	t.Helper()
+	got := f.deletions()
+	if len(got) != len(want) {
+		t.Fatalf("deleted %q, want %q", got, want)
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Fatalf("deleted %q, want %q", got, want)
+		}
+	}
+}
+
+func checkTornDown(t *testing.T, res runResult) {
+	t.Helper()
+	if len(res.Leftover) > 0 {
+		t.Errorf("left behind %v", res.Leftover)
+	}
+	if _, err := os.Stat(res.StateFile); !os.IsNotExist(err) {
+		t.Errorf("state file %s kept after a clean teardown", res.StateFile)
+	}
+}
+
+func TestValidateInstance(t *testing.T) {
+	b, f := newFakeBackend()
+
+	res := runTarget(t, b, target{Kind: "instance", ID: "demo-db"})
+	if res.Err != nil {
+		t.Fatalf("run failed: %v", res.Err)
+	}
+	// the newest snapshot is still being created
+	if res.Snapshot != "rds:demo-db-1" {
+		t.Errorf("restored %s, want rds:demo-db-1", res.Snapshot)
+	}
+	if res.exitCode() != exitPassed {
+		t.Errorf("exit code %d, want %d", res.exitCode(), exitPassed)
+	}
+	checkTornDown(t, res)
+	checkDeletions(t, f, kindDBInstance+" demo-db-")
+}
+
+func TestValidateClusterTearsDownInReverse(t *testing.T) {
+	b, f := newFakeBackend()
+
+	res := runTarget(t, b, target{Kind: "cluster", ID: "demo-cluster"})
+	if res.Err != nil {
+		t.Fatalf("run failed: %v", res.Err)
+	}
+	checkTornDown(t, res)
+	// the member instance was created last, so goes first
+	checkDeletions(t, f, kindDBInstance+" demo-cluster-", kindDBCluster+" demo-cluster-")
+}
+
+func TestValidateCrossAccountDeletesEveryCopy(t *testing.T) {
+	b, f := newFakeBackend()
+	withFakeSource(b, fakeSourceAccount)
+
+	res := runTarget(t, b, target{Kind: "instance", ID: "demo-db"})
+	if res.Err != nil {
+		t.Fatalf("run failed: %v", res.Err)
+	}
+	checkTornDown(t, res)
+	// database, then the local copy, then the copy shared from the source
+	checkDeletions(t, f, kindDBInstance+" ", kindDBSnapshot+" rdsvalidator-", kindDBSnapshot+" rdsvalidator-")
+}
+
+func TestValidateCrossAccountInTargetRegion(t *testing.T) {
+	setGlobal(t, &sourceProfile, "backups")
+	b, f := newFakeBackend()
+	// no --region: the target's region came from its profile
+	b.opts = sessionOptions{profile: "prod"}
+
+	source := b.sourceSession()
+	if want := (sessionOptions{region: fakeRegion, profile: "backups"}); source != want {
+		t.Fatalf("source session %+v, want %+v", source, want)
+	}
+	withFakeSource(b, fakeSourceAccount)
+	b.src.opts = source
+
+	res := runTarget(t, b, target{Kind: "instance", ID: "demo-db"})
+	if res.Err != nil {
+		t.Fatalf("run failed: %v", res.Err)
+	}
+	checkTornDown(t, res)
+	checkDeletions(t, f, kindDBInstance+" ", kindDBSnapshot+" rdsvalidator-", kindDBSnapshot+" rdsvalidator-")
+
+	setGlobal(t, &copyFromRegion, "us-west-2")
+	if got := b.sourceSession().region; got != "us-west-2" {
+		t.Errorf("--copy-from-region gave a source in %s", got)
+	}
+}
+
+func TestSnapshotCopyPhase(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		want    bool
+	}{
+		{name: "same account", account: fakeAccount},
+		{name: "other account", account: fakeSourceAccount, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newFakeBackend()
+			withFakeSource(b, tt.account)
+
+			res := runTarget(t, b, target{Kind: "instance", ID: "demo-db"})
+			if res.Err != nil {
+				t.Fatalf("run failed: %v", res.Err)
+			}
+			got := false
+			for _, p := range res.Phases {
+				got = got || p.Name == "snapshot copy"
+			}
+			if got != tt.want {
+				t.Errorf("snapshot copy phase recorded: %v, want %v in %+v", got, tt.want, res.Phases)
+			}
+		})
+	}
+}
+
+func TestValidateStaleBackup(t *testing.T) {
+	setGlobal(t, &maxSnapshotAge, time.Minute)
+	b, f := newFakeBackend()
+
+	res := runTarget(t, b, target{Kind: "instance", ID: "demo-db"})
+	if !errors.Is(res.Err, errStaleBackup) {
+		t.Fatalf("got %v, want a stale backup", res.Err)
+	}
+	if res.exitCode() != exitStale {
+		t.Errorf("exit code %d, want %d", res.exitCode(), exitStale)
+	}
+	checkTornDown(t, res)
+	checkDeletions(t, f)
+}
+
+func TestValidateStaleBackupCopiedFresh(t *testing.T) {
+	b, f := newFakeBackend()
+	// a DR copy of the oldest backup, made just now
+	_, err := f.CopyDBSnapshot(context.Background(), &rds.CopyDBSnapshotInput{
+		SourceDBSnapshotIdentifier: aws.String("rds:demo-db-10"),
+		TargetDBSnapshotIdentifier: aws.String("demo-db-dr"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(f.copies, "demo-db-dr")
+	f.snapshots[len(f.snapshots)-1].Status = aws.String("available")
+
+	s, newest, err := b.getInstanceSnapshot(context.Background(), "demo-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := aws.ToString(s.DBSnapshotIdentifier); id != "rds:demo-db-1" {
+		t.Errorf("latest is %s, want rds:demo-db-1", id)
+	}
+	if age := time.Since(newest); age < 23*time.Hour {
+		t.Errorf("newest backup is %s old, want a day", age)
+	}
+
+	setGlobal(t, &maxSnapshotAge, 2*time.Hour)
+	res := runTarget(t, b, target{Kind: "instance", ID: "demo-db"})
+	if !errors.Is(res.Err, errStaleBackup) {
+		t.Fatalf("got %v, want a stale backup", res.Err)
+	}
+	checkDeletions(t, f)
+}
+
+func TestValidatePointInTime(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name   string
+		latest bool
+		at     time.Time
+		err    string
+	}{
+		{name: "latest restorable", latest: true},
+		{name: "in window", at: now.Add(-time.Hour)},
+		{name: "after latest", at: now.Add(time.Hour), err: "after the latest restorable time"},
+		{name: "before earliest", at: now.Add(-30 * 24 * time.Hour), err: "before the earliest restorable time"},
+	}
+	targets := []struct {
+		target
+		deleted []string // prefixes, newest first
+	}{
+		{target{Kind: "cluster", ID: "demo-cluster"}, []string{kindDBInstance + " demo-cluster-", kindDBCluster + " demo-cluster-"}},
+		{target{Kind: "instance", ID: "demo-db"}, []string{kindDBInstance + " demo-db-"}},
+	}
+
+	for _, tg := range targets {
+		for _, tt := range tests {
+			t.Run(tg.Kind+" "+tt.name, func(t *testing.T) {
+				setGlobal(t, &latestRestorable, tt.latest)
+				setGlobal(t, &restoreTime, "")
+				if !tt.at.IsZero() {
+					setGlobal(t, &restoreTime, tt.at.Format(time.RFC3339))
+				}
+				b, f := newFakeBackend()
+
+				res := runTarget(t, b, tg.target)
+				checkTornDown(t, res)
+				if len(tt.err) > 0 {
+					if res.Err == nil || !strings.Contains(res.Err.Error(), tt.err) {
+						t.Fatalf("got %v, want an error containing %q", res.Err, tt.err)
+					}
+					if res.exitCode() != exitError {
+						t.Errorf("exit code %d, want %d", res.exitCode(), exitError)
+					}
+					checkDeletions(t, f)
+					return
+				}
+
+				if res.Err != nil {
+					t.Fatalf("run failed: %v", res.Err)
+				}
+				if !strings.HasPrefix(res.Snapshot, tg.ID+" at ") {
+					t.Errorf("restored %q, want a point in time of %s", res.Snapshot, tg.ID)
+				}
+				checkDeletions(t, f, tg.deleted...)
+			})
+		}
+	}
+}
+
+func TestValidateRandomSnapshotJudgedByNewest(t *testing.T) {
+	setGlobal(t, &maxSnapshotAge, 26*time.Hour)
+	setGlobal(t, &snapshotStrategy, strategyRandom)
+	b, _ := newFakeBackend()
+
+	// the newest available snapshot is a day old, most picks are older
+	for i := 0; i < 5; i++ {
+		res := runTarget(t, b, target{Kind: "instance", ID: "demo-db"})
+		if res.Err != nil {
+			t.Fatalf("restoring %s: %v", res.Snapshot, res.Err)
+		}
+	}
+}
+
+func TestValidateFailingScript(t *testing.T) {
+	b, f := newFakeBackend()
+
+	res := runTarget(t, b, target{Kind: "instance", ID: "demo-db", PostDir: writeScript(t, "exit 3")})
+	if !errors.Is(res.Err, errCheckFailed) {
+		t.Fatalf("got %v, want a failed check", res.Err)
+	}
+	if res.exitCode() != exitFailed {
+		t.Errorf("exit code %d, want %d", res.exitCode(), exitFailed)
+	}
+	checkTornDown(t, res)
+	checkDeletions(t, f, kindDBInstance+" demo-db-")
+}
+
+// stopScript returns a script that sleeps until killed, and a context
+// that is ended by stop once the script has started.
+func stopScript(t *testing.T, ctx context.Context, stop func()) string {
+	t.Helper()
+	started := filepath.Join(t.TempDir(), "started")
+	go func() {
+		for {
+			if _, err := os.Stat(started); err == nil {
+				stop()
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	return writeScript(t, "touch "+started+"\nexec sleep 30")
+}
+
+func TestValidateInterruptedScript(t *testing.T) {
+	b, f := newFakeBackend()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res := runTargetContext(t, ctx, b, target{Kind: "instance", ID: "demo-db", PostDir: stopScript(t, ctx, cancel)})
+	if !errors.Is(res.Err, context.Canceled) {
+		t.Fatalf("got %v, want an interruption", res.Err)
+	}
+	if res.status() != "INTERRUPTED" || res.exitCode() != exitInterrupted {
+		t.Errorf("got %s with exit code %d, want INTERRUPTED with %d", res.status(), res.exitCode(), exitInterrupted)
+	}
+	checkTornDown(t, res)
+	checkDeletions(t, f, kindDBInstance+" demo-db-")
+}
+
+func TestValidateTimedOutScript(t *testing.T) {
+	b, f := newFakeBackend()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// a script killed by the deadline is not a failed check
+	res := runTargetContext(t, ctx, b, target{Kind: "instance", ID: "demo-db", PostDir: writeScript(t, "exec sleep 30")})
+	if !errors.Is(res.Err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a timeout", res.Err)
+	}
+	if res.exitCode() != exitError {
+		t.Errorf("exit code %d, want %d", res.exitCode(), exitError)
+	}
+	checkTornDown(t, res)
+	checkDeletions(t, f, kindDBInstance+" demo-db-")
+}
+
+func TestValidateScriptSeesDatabase(t *testing.T) {
+	b, _ := newFakeBackend()
+	out := filepath.Join(t.TempDir(), "env")
+
+	res := runTarget(t, b, target{Kind: "instance", ID: "demo-db", PostDir: writeScript(t, `echo "$DB_HOST:$DB_PORT" > `+out)})
+	if res.Err != nil {
+		t.Fatalf("run failed: %v", res.Err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(got), "demo-db-") || !strings.HasSuffix(string(got), ":5432\n") {
+		t.Errorf("script saw %q", got)
+	}
+}
+
+func TestValidateCreatedProxy(t *testing.T) {
+	instance := target{Kind: "instance", ID: "demo-db"}
+	tests := []struct {
+		name    string
+		target  target
+		ingress []string
+		ipv4    []string
+		ipv6    []string
+		dbs     []string // database deletions, in order
+	}{
+		{name: "detected egress IP", target: instance, ipv4: []string{"192.0.2.10/32"}, dbs: []string{kindDBInstance + " demo-db-"}},
+		{name: "given CIDRs", target: instance, ingress: []string{"203.0.113.0/24", "2001:db8::/32"}, ipv4: []string{"203.0.113.0/24"}, ipv6: []string{"2001:db8::/32"}, dbs: []string{kindDBInstance + " demo-db-"}},
+		{name: "cluster", target: target{Kind: "cluster", ID: "demo-cluster"}, ipv4: []string{"192.0.2.10/32"}, dbs: []string{kindDBInstance + " demo-cluster-", kindDBCluster + " demo-cluster-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the proxy is a local sshd, forwarding to an echo server in
+			// place of the database
+			echo := net.JoinHostPort("127.0.0.1", strconv.Itoa(startEcho(t)))
+			port, hostKey := startProxy(t, func(string) string { return echo })
+			setGlobal(t, &proxyCreate, true)
+			setGlobal(t, &proxyVPC, "vpc-1")
+			setGlobal(t, &proxySubnet, "subnet-1")
+			setGlobal(t, &proxyPort, port)
+			setGlobal(t, &proxyIngress, tt.ingress)
+			b, f := newFakeBackend()
+			f.hostIP = "127.0.0.1"
+			f.hostFingerprint = ssh.FingerprintSHA256(hostKey)
+
+			res := runTarget(t, b, tt.target)
+			if res.Err != nil {
+				t.Fatalf("run failed: %v", res.Err)
+			}
+			checkTornDown(t, res)
+			want := []string{kindProxy + " i-", kindKeypair + " key-"}
+			want = append(want, tt.dbs...)
+			checkDeletions(t, f, append(want, kindSecurityGroup+" sg-", kindSecurityGroup+" sg-")...)
+
+			// the database's group refers to the proxy's, so goes first
+			if len(f.removedGroups) != 2 {
+				t.Fatalf("deleted %d security groups, want 2", len(f.removedGroups))
+			}
+			db, proxy := f.removedGroups[0], f.removedGroups[1]
+			if !strings.HasSuffix(aws.ToString(db.Description), "database") || !strings.HasSuffix(aws.ToString(proxy.Description), "proxy") {
+				t.Fatalf("deleted %q then %q, want the database group first", aws.ToString(db.Description), aws.ToString(proxy.Description))
+			}
+
+			if len(proxy.IpPermissions) != 1 {
+				t.Fatalf("proxy group admits %+v, want one rule", proxy.IpPermissions)
+			}
+			p := proxy.IpPermissions[0]
+			var ipv4, ipv6 []string
+			for _, r := range p.IpRanges {
+				ipv4 = append(ipv4, aws.ToString(r.CidrIp))
+			}
+			for _, r := range p.Ipv6Ranges {
+				ipv6 = append(ipv6, aws.ToString(r.CidrIpv6))
+			}
+			if aws.ToString(p.IpProtocol) != "tcp" || aws.ToInt32(p.FromPort) != int32(port) || aws.ToInt32(p.ToPort) != int32(port) ||
+				strings.Join(ipv4, ",") != strings.Join(tt.ipv4, ",") || strings.Join(ipv6, ",") != strings.Join(tt.ipv6, ",") || len(p.UserIdGroupPairs) > 0 {
+				t.Errorf("proxy group admits %s %d-%d from %v %v %v, want tcp %d from %v %v", aws.ToString(p.IpProtocol), aws.ToInt32(p.FromPort), aws.ToInt32(p.ToPort), ipv4, ipv6, p.UserIdGroupPairs, port, tt.ipv4, tt.ipv6)
+			}
+
+			if len(db.IpPermissions) != 1 {
+				t.Fatalf("database group admits %+v, want one rule", db.IpPermissions)
+			}
+			p = db.IpPermissions[0]
+			if aws.ToString(p.IpProtocol) != "tcp" || aws.ToInt32(p.FromPort) != 5432 || aws.ToInt32(p.ToPort) != 5432 ||
+				len(p.IpRanges) > 0 || len(p.Ipv6Ranges) > 0 || len(p.UserIdGroupPairs) != 1 || aws.ToString(p.UserIdGroupPairs[0].GroupId) != aws.ToString(proxy.GroupId) {
+				t.Errorf("database group admits %+v, want only tcp 5432 from %s", p, aws.ToString(proxy.GroupId))
+			}
+		})
+	}
+}
+
+func TestValidateMissingSource(t *testing.T) {
+	b, f := newFakeBackend()
+
+	res := runTarget(t, b, target{Kind: "instance", ID: "missing"})
+	if res.Err == nil {
+		t.Fatal("run passed without a source database")
+	}
+	if res.exitCode() != exitError {
+		t.Errorf("exit code %d, want %d", res.exitCode(), exitError)
+	}
+	checkTornDown(t, res)
+	checkDeletions(t, f)
+}
+
+func TestCheckRunFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(t *testing.T)
+		err  string
+	}{
+		{
+			name: "defaults",
+			set:  func(t *testing.T) {},
+		},
+		{
+			name: "existing proxy",
+			set: func(t *testing.T) {
+				setGlobal(t, &proxy, "proxy.example.com")
+				setGlobal(t, &proxyKey, "id_ed25519")
+			},
+		},
+		{
+			name: "created proxy",
+			set: func(t *testing.T) {
+				setGlobal(t, &proxyCreate, true)
+				setGlobal(t, &proxyVPC, "vpc-1")
+				setGlobal(t, &proxySubnet, "subnet-1")
+			},
+		},
+		{
+			name: "existing and created proxy",
+			set: func(t *testing.T) {
+				setGlobal(t, &proxy, "proxy.example.com")
+				setGlobal(t, &proxyKey, "id_ed25519")
+				setGlobal(t, &proxyCreate, true)
+				setGlobal(t, &proxyVPC, "vpc-1")
+				setGlobal(t, &proxySubnet, "subnet-1")
+			},
+			err: "--proxy and --proxy-create are mutually exclusive",
+		},
+		{
+			name: "created proxy without network",
+			set: func(t *testing.T) {
+				setGlobal(t, &proxyCreate, true)
+			},
+			err: "Must provide --proxy-vpc and --proxy-subnet",
+		},
+		{
+			name: "existing proxy without key",
+			set: func(t *testing.T) {
+				setGlobal(t, &proxy, "proxy.example.com")
+			},
+			err: "Must provide --proxy-key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.set(t)
+
+			err := checkRunFlags()
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCollectTargets(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines string
+		want  []target
+		err   string
+	}{
+		{
+			name:  "comments and blank lines",
+			lines: "# nightly\n\ncluster demo-cluster\n  instance demo-db  \n# instance old-db\n",
+			want: []target{
+				{Kind: "cluster", ID: "flag-cluster", PreDir: "pre"},
+				{Kind: "instance", ID: "flag-db", PreDir: "pre"},
+				{Kind: "cluster", ID: "demo-cluster", PreDir: "pre"},
+				{Kind: "instance", ID: "demo-db", PreDir: "pre"},
+			},
+		},
+		{
+			name:  "unknown kind",
+			lines: "# nightly\ncluster demo-cluster\n\ndatabase demo-db\n",
+			err:   "targets:4: expected",
+		},
+		{
+			name:  "missing ID",
+			lines: "instance\n",
+			err:   "targets:1: expected",
+		},
+		{
+			name:  "extra field",
+			lines: "instance demo-db nightly\n",
+			err:   "targets:1: expected",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "targets")
+			err := os.WriteFile(path, []byte(tt.lines), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setGlobal(t, &targetsFile, path)
+			setGlobal(t, &clusterIDs, []string{"flag-cluster"})
+			setGlobal(t, &instanceIDs, []string{"flag-db"})
+			setGlobal(t, &preDir, "pre")
+
+			got, err := collectTargets()
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("target %d is %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	// without --state, each run writes its own state file here
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	setGlobal(t, &concurrency, 2)
+
+	// each pre script notes how many are running, itself included
+	running := t.TempDir()
+	counts := filepath.Join(t.TempDir(), "counts")
+	pre := writeScript(t, `touch "`+running+`/$$"
+ls "`+running+`" | wc -l >> "`+counts+`"
+sleep 0.2
+rm "`+running+`/$$"`)
+
+	targets := []target{
+		{Kind: "instance", ID: "demo-db", PreDir: pre},
+		{Kind: "cluster", ID: "demo-cluster", PreDir: pre},
+		{Kind: "instance", ID: "missing-db", PreDir: pre},
+		{Kind: "instance", ID: "demo-db", PreDir: pre},
+		{Kind: "cluster", ID: "demo-cluster", PreDir: pre},
+	}
+	b, _ := newFakeBackend()
+	results := validateAll(context.Background(), b, targets)
+
+	if len(results) != len(targets) {
+		t.Fatalf("got %d results for %d targets", len(results), len(targets))
+	}
+	for i, res := range results {
+		if res.Target != targets[i] {
+			t.Errorf("result %d is for %+v, want %+v", i, res.Target, targets[i])
+		}
+		if failed := res.Err != nil; failed != (targets[i].ID == "missing-db") {
+			t.Errorf("result %d (%s %s): %v", i, targets[i].Kind, targets[i].ID, res.Err)
+		}
+	}
+
+	out, err := os.ReadFile(counts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) != len(targets) {
+		t.Errorf("pre scripts ran %d times, want %d", len(lines), len(targets))
+	}
+	most := 0
+	for _, l := range lines {
+		n, err := strconv.Atoi(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > most {
+			most = n
+		}
+	}
+	if most != concurrency {
+		t.Errorf("at most %d ran at once, want %d", most, concurrency)
+	}
+}
+
+func TestCreateWithin(t *testing.T) {
+	setGlobal(t, &maxRestoreDuration, 50*time.Millisecond)
+	ctx := context.Background()
+
+	_, err := createWithin(ctx, func(context.Context) (createDBResult, error) {
+		return createDBResult{Phases: []phase{{Name: "instance available", Duration: 10 * time.Millisecond}}}, nil
+	})
+	if err != nil {
+		t.Errorf("quick restore failed: %v", err)
+	}
+
+	_, err = createWithin(ctx, func(ctx context.Context) (createDBResult, error) {
+		<-ctx.Done()
+		return createDBResult{}, ctx.Err()
+	})
+	if !errors.Is(err, errCheckFailed) || !strings.Contains(err.Error(), "did not finish within") {
+		t.Errorf("got %v for an abandoned restore", err)
+	}
+
+	_, err = createWithin(ctx, func(context.Context) (createDBResult, error) {
+		return createDBResult{Phases: []phase{{Name: "cluster restore", Duration: 40 * time.Millisecond}, {Name: "instance available", Duration: 20 * time.Millisecond}}}, nil
+	})
+	if !errors.Is(err, errCheckFailed) || !strings.Contains(err.Error(), "restore took") {
+		t.Errorf("got %v for a restore over the limit", err)
+	}
+}
+
+func TestMaxRestoreDurationSkipsCopies(t *testing.T) {
+	setGlobal(t, &maxRestoreDuration, 150*time.Millisecond)
+	setGlobal(t, &copyFromRegion, "us-west-2")
+	b, _ := newFakeBackend()
+	withFakeSource(b, fakeAccount)
+
+	// polls before the restore deadline starts, i.e. the copy's, take time
+	var copying time.Duration
+	restoring := false
+	b.sleep = func(ctx context.Context, _ time.Duration) error {
+		if dl, ok := ctx.Deadline(); ok && time.Until(dl) <= maxRestoreDuration {
+			restoring = true
+		}
+		if !restoring {
+			time.Sleep(100 * time.Millisecond)
+			copying += 100 * time.Millisecond
+		}
+		return ctx.Err()
+	}
+
+	res := runTarget(t, b, target{Kind: "instance", ID: "demo-db"})
+	if res.Err != nil {
+		t.Fatalf("run failed: %v", res.Err)
+	}
+	if copying <= maxRestoreDuration {
+		t.Fatalf("copy took %s, want more than %s for the test to mean anything", copying, maxRestoreDuration)
+	}
+}
+
+func TestExitCodePrecedence(t *testing.T) {
+	failed := runResult{Err: errCheckFailed}
+	stale := runResult{Err: errStaleBackup}
+	leaked := runResult{Leftover: []error{errors.New("sg-1")}}
+	broken := runResult{Err: errors.New("access denied")}
+
+	tests := []struct {
+		results []runResult
+		want    int
+	}{
+		{[]runResult{{}, {}}, exitPassed},
+		{[]runResult{{}, broken}, exitError},
+		{[]runResult{broken, failed}, exitFailed},
+		{[]runResult{failed, stale}, exitStale},
+		{[]runResult{stale, leaked, failed}, exitCleanup},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.results); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.results, got, tt.want)
+		}
+	}
+}
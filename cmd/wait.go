@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// how long to wait on AWS before giving up
+const (
+	ec2WaitLimit  = 15 * time.Minute
+	dbWaitLimit   = 4 * time.Hour
+	copyWaitLimit = 12 * time.Hour
+)
+
+// statuses RDS resources never recover from on their own
+var failedStates = map[string]bool{
+	"failed":                              true,
+	"inaccessible-encryption-credentials": true,
+	"incompatible-credentials":            true,
+	"incompatible-network":                true,
+	"incompatible-option-group":           true,
+	"incompatible-parameters":             true,
+	"incompatible-restore":                true,
+	"restore-error":                       true,
+	"storage-full":                        true,
+}
+
+// checkStatus fails if status is one of failedStates.
+func checkStatus(what, status string) error {
+	if failedStates[status] {
+		return fmt.Errorf("%s is %s", what, status)
+	}
+	return nil
+}
+
+// poll calls check until it reports done or fails, backing off
+// exponentially from interval and printing a dot per attempt. It gives up
+// after limit, or sooner if ctx ends.
+func (b *backend) poll(ctx context.Context, what string, interval, limit time.Duration, check func(context.Context) (bool, error)) error {
+	pctx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+
+	delay := interval
+	for {
+		err := b.sleep(pctx, delay)
+		if err == nil {
+			var done bool
+			done, err = check(pctx)
+			if done || (err != nil && pctx.Err() == nil) {
+				return err
+			}
+		}
+		if errors.Is(pctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return fmt.Errorf("timed out after %s waiting for %s", limit, what)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for %s: %w", what, ctx.Err())
+		}
+		fmt.Fprint(b.out, ".")
+
+		delay *= 2
+		if delay > 8*interval {
+			delay = 8 * interval
+		}
+	}
+}
+
+// sleepContext sleeps for d or until ctx ends.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
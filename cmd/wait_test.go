@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// countPolls counts b's sleeps, one per poll, cancelling the returned
+// context should a wait go on past max polls.
+func countPolls(t *testing.T, b *backend, max int) (context.Context, *int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	n := new(int)
+	b.sleep = func(ctx context.Context, _ time.Duration) error {
+		*n++
+		if *n > max {
+			cancel()
+		}
+		return ctx.Err()
+	}
+	return ctx, n
+}
+
+// checkFailedWait expects err to report what in status, after only the
+// polls it took to get there.
+func checkFailedWait(t *testing.T, err error, what, status string, polls int) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), what+" is "+status) {
+		t.Fatalf("got %v, want %s reported %s", err, what, status)
+	}
+	if polls != fakeSteps {
+		t.Errorf("polled %d times, want %d", polls, fakeSteps)
+	}
+}
+
+func TestWaitForInstanceFails(t *testing.T) {
+	b, f := newFakeBackend()
+	f.failStatus = "incompatible-restore"
+	f.instances["demo-db-restore"] = f.newInstance("demo-db-restore", "postgres", "creating")
+	ctx, polls := countPolls(t, b, 10)
+
+	_, err := b.waitForInstance(ctx, "demo-db-restore")
+	checkFailedWait(t, err, "instance demo-db-restore", "incompatible-restore", *polls)
+}
+
+func TestFinishClusterFails(t *testing.T) {
+	b, f := newFakeBackend()
+	f.failStatus = "failed"
+	f.clusters["demo-cluster-restore"] = &rdstypes.DBCluster{
+		DBClusterIdentifier: aws.String("demo-cluster-restore"),
+		Engine:              aws.String("aurora-postgresql"),
+		Status:              aws.String("creating"),
+	}
+	ctx, polls := countPolls(t, b, 10)
+
+	_, err := b.finishCluster(ctx, "demo-cluster-restore", aws.String("aurora-postgresql"), newTestLedger(t, b))
+	checkFailedWait(t, err, "cluster demo-cluster-restore", "failed", *polls)
+	if _, ok := f.instances["demo-cluster-restore-instance-1"]; ok {
+		t.Error("added an instance to a failed cluster")
+	}
+}
+
+func TestCopyInstanceSnapshotFails(t *testing.T) {
+	b, f := newFakeBackend()
+	f.failStatus = "failed"
+	ctx, polls := countPolls(t, b, 10)
+
+	s, err := b.copyInstanceSnapshot(ctx, f.snapshots[1], "", "", newTestLedger(t, b))
+	checkFailedWait(t, err, "snapshot "+aws.ToString(s.DBSnapshotIdentifier), "failed", *polls)
+}
+
+func TestPollGivesUpAfterLimit(t *testing.T) {
+	b, _ := newFakeBackend()
+	sleeps, checks := 0, 0
+	// the first sleep outlasts the limit
+	b.sleep = func(ctx context.Context, _ time.Duration) error {
+		sleeps++
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	err := b.poll(context.Background(), "demo", time.Second, 10*time.Millisecond, func(context.Context) (bool, error) {
+		checks++
+		return false, nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 10ms waiting for demo") {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	if sleeps != 1 || checks != 0 {
+		t.Errorf("slept %d and checked %d times, want once and never", sleeps, checks)
+	}
+}
+
+func TestPollParentCancelled(t *testing.T) {
+	b, _ := newFakeBackend()
+	ctx, polls := countPolls(t, b, 2)
+	checks := 0
+
+	err := b.poll(ctx, "demo", time.Second, time.Hour, func(context.Context) (bool, error) {
+		checks++
+		return false, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want the parent's context.Canceled", err)
+	}
+	if strings.Contains(err.Error(), "timed out") {
+		t.Errorf("cancellation reported as a timeout: %v", err)
+	}
+	if *polls != 3 || checks != 2 {
+		t.Errorf("slept %d and checked %d times, want 3 and 2", *polls, checks)
+	}
+}